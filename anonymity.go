@@ -0,0 +1,289 @@
+package proxychecker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type AnonymityLevel string
+
+const (
+    // Transparent proxies reveal the origin IP to the destination.
+    Transparent AnonymityLevel = "transparent"
+    // Anonymous proxies hide the origin IP but announce themselves as proxies.
+    Anonymous AnonymityLevel = "anonymous"
+    // Elite proxies neither reveal the origin IP nor identify as proxies.
+    Elite AnonymityLevel = "elite"
+)
+
+// proxyHeaders are request headers that give away that a proxy sits between
+// the client and the judge.
+var proxyHeaders = []string{
+    "Via",
+    "X-Forwarded-For",
+    "Forwarded",
+    "X-Real-Ip",
+    "Client-Ip",
+    "Proxy-Connection",
+}
+
+func (l AnonymityLevel) rank() int {
+    switch l {
+    case Transparent:
+        return 1
+    case Anonymous:
+        return 2
+    case Elite:
+        return 3
+    }
+    return 0
+}
+
+// AtLeast reports whether l hides at least as much as level.
+func (l AnonymityLevel) AtLeast(level AnonymityLevel) bool {
+    return l.rank() >= level.rank()
+}
+
+// judgeEcho is what an echo judge reports about the request it received.
+type judgeEcho struct {
+    Headers http.Header
+    Origin  string
+    Method  string
+    URL     string
+}
+
+// parseJudgeEcho understands httpbin style JSON ({"headers": ..., "origin": ...})
+// and azenv style "HTTP_X_FORWARDED_FOR = value" listings.
+func parseJudgeEcho(body []byte) (judgeEcho, error) {
+    echo := judgeEcho{Headers: http.Header{}}
+    var payload struct {
+        Headers map[string]string `json:"headers"`
+        Origin  string            `json:"origin"`
+        Method  string            `json:"method"`
+        URL     string            `json:"url"`
+    }
+    if err := json.Unmarshal(body, &payload); err == nil {
+        for key, value := range payload.Headers {
+            echo.Headers.Set(key, value)
+        }
+        echo.Origin = payload.Origin
+        echo.Method = payload.Method
+        echo.URL = payload.URL
+        return echo, nil
+    }
+
+    scanner := bufio.NewScanner(bytes.NewReader(body))
+    for scanner.Scan() {
+        key, value, found := strings.Cut(scanner.Text(), "=")
+        if !found {
+            continue
+        }
+        key = strings.TrimSpace(key)
+        value = strings.TrimSpace(value)
+        if key == "REMOTE_ADDR" {
+            echo.Origin = value
+        } else if key == "REQUEST_METHOD" {
+            echo.Method = value
+        } else if key == "REQUEST_URI" {
+            echo.URL = value
+        } else if strings.HasPrefix(key, "HTTP_") {
+            name := strings.ReplaceAll(strings.TrimPrefix(key, "HTTP_"), "_", "-")
+            echo.Headers.Set(name, value)
+        }
+    }
+    if echo.Origin == "" && len(echo.Headers) == 0 {
+        return echo, errors.New("judge response is not an echo of the request")
+    }
+    return echo, nil
+}
+
+func classifyAnonymity(echo judgeEcho, originIP string) AnonymityLevel {
+    if originIP != "" {
+        if containsIP(echo.Origin, originIP) {
+            return Transparent
+        }
+        for _, values := range echo.Headers {
+            for _, value := range values {
+                if containsIP(value, originIP) {
+                    return Transparent
+                }
+            }
+        }
+    }
+    for _, header := range proxyHeaders {
+        if echo.Headers.Get(header) != "" {
+            return Anonymous
+        }
+    }
+    return Elite
+}
+
+// containsIP reports whether ip appears as a whole token in s, so that
+// 1.2.3.4 does not match 11.2.3.45.
+func containsIP(s, ip string) bool {
+    fields := strings.FieldsFunc(s, func(r rune) bool {
+        return r == ',' || r == ';' || r == ' ' || r == '=' || r == '"'
+    })
+    for _, field := range fields {
+        if host, _, err := net.SplitHostPort(field); err == nil {
+            field = host
+        }
+        if strings.Trim(field, "[]") == ip {
+            return true
+        }
+    }
+    return false
+}
+
+func (pc *ProxyChecker) fetchJudgeEcho(ctx context.Context, client *http.Client, judge string) (judgeEcho, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", judge, nil)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    return pc.doJudgeEcho(client, req)
+}
+
+func (pc *ProxyChecker) doJudgeEcho(client *http.Client, req *http.Request) (judgeEcho, error) {
+    resp, err := client.Do(req)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    if resp.StatusCode != http.StatusOK {
+        return judgeEcho{}, errors.New("judge returned " + resp.Status)
+    }
+    return parseJudgeEcho(body)
+}
+
+// originRetryInterval is how long a failed origin IP lookup is remembered
+// before the judges are asked again.
+const originRetryInterval = time.Minute
+
+// originLookup is a lookup of our own IP, shared by the checks waiting for it.
+type originLookup struct {
+    done chan struct{}
+    ip   string
+    err  error
+    at   time.Time
+    // canceled is set when the caller's context ended the lookup, which
+    // says nothing about the judges.
+    canceled bool
+}
+
+// originIP returns the IP address the judges see when no proxy is used. Only
+// one lookup runs at a time and a failed one is reused for a while, so that
+// checks don't queue up behind unreachable judges.
+func (pc *ProxyChecker) originIP(ctx context.Context) (string, error) {
+    if pc.OriginIP != "" {
+        return pc.OriginIP, nil
+    }
+    for {
+        pc.originLock.Lock()
+        lookup := pc.originLookup
+        if lookup == nil || lookup.expired() {
+            lookup = &originLookup{done: make(chan struct{})}
+            pc.originLookup = lookup
+            pc.originLock.Unlock()
+            pc.lookupOrigin(ctx, lookup)
+            return lookup.ip, lookup.err
+        }
+        pc.originLock.Unlock()
+        select {
+        case <-lookup.done:
+            if !lookup.canceled {
+                return lookup.ip, lookup.err
+            }
+        case <-ctx.Done():
+            return "", ctx.Err()
+        }
+    }
+}
+
+// expired reports whether a finished lookup failed long enough ago to be
+// retried. originLock must be held.
+func (l *originLookup) expired() bool {
+    select {
+    case <-l.done:
+        return l.err != nil && time.Since(l.at) >= originRetryInterval
+    default:
+        return false
+    }
+}
+
+func (pc *ProxyChecker) lookupOrigin(ctx context.Context, lookup *originLookup) {
+    judges := pc.anonymityJudges()
+    echo, err := pc.fetchJudgeEcho(ctx, pc.Client, judges[rand.Intn(len(judges))])
+    if err == nil {
+        lookup.ip = strings.TrimSpace(strings.Split(echo.Origin, ",")[0])
+        if net.ParseIP(lookup.ip) == nil {
+            lookup.ip, err = "", errors.New("judge did not report a usable origin address")
+        }
+    }
+    pc.originLock.Lock()
+    lookup.err, lookup.at = err, time.Now()
+    if err != nil && ctx.Err() != nil {
+        lookup.canceled = true
+        pc.originLookup = nil
+    }
+    close(lookup.done)
+    pc.originLock.Unlock()
+}
+
+func (pc *ProxyChecker) anonymityJudges() []string {
+    if len(pc.AnonymityJudges) > 0 {
+        return pc.AnonymityJudges
+    }
+    return anonymityJudges
+}
+
+// checkAnonymity asks an echo judge what it received through the proxy and
+// classifies the proxy accordingly.
+func (pc *ProxyChecker) checkAnonymity(ctx context.Context, p Proxy) (AnonymityLevel, error) {
+    originIP, err := pc.originIP(ctx)
+    if err != nil {
+        return "", err
+    }
+    transport, release, err := pc.transport(ctx, p)
+    if err != nil {
+        return "", err
+    }
+    defer release()
+    client := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+    }
+    judges := pc.anonymityJudges()
+    echo, err := pc.fetchJudgeEcho(ctx, client, judges[rand.Intn(len(judges))])
+    if err != nil {
+        return "", err
+    }
+    return classifyAnonymity(echo, originIP), nil
+}
+
+// GetProxiesByAnonymity returns the cached proxies whose anonymity level is
+// at least level. Proxies that were not classified are never returned.
+func (pc *ProxyChecker) GetProxiesByAnonymity(level AnonymityLevel) []Proxy {
+    var proxies []Proxy
+    for _, proxy := range pc.GetAllProxies() {
+        if proxy.Anonymity != "" && proxy.Anonymity.AtLeast(level) {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
@@ -0,0 +1,131 @@
+package proxychecker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newEchoJudge(t *testing.T) *httptest.Server {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        headers := map[string]string{}
+        for key := range r.Header {
+            headers[key] = r.Header.Get(key)
+        }
+        host, _, _ := net.SplitHostPort(r.RemoteAddr)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "headers": headers,
+            "origin":  host,
+            "method":  r.Method,
+            "url":     "http://" + r.Host + r.URL.RequestURI(),
+        })
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestCheckAnonymity(t *testing.T) {
+    const origin = "203.0.113.7"
+    judge := newEchoJudge(t)
+
+    tests := []struct {
+        name    string
+        rewrite func(*http.Request)
+        want    AnonymityLevel
+    }{
+        {"transparent", func(r *http.Request) {
+            r.Header.Set("X-Forwarded-For", origin)
+        }, Transparent},
+        {"transparent forwarded", func(r *http.Request) {
+            r.Header.Set("Forwarded", "for="+origin+";proto=http")
+        }, Transparent},
+        {"anonymous", func(r *http.Request) {
+            r.Header.Set("Via", "1.1 squid")
+        }, Anonymous},
+        {"elite", nil, Elite},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pc := NewProxyChecker()
+            pc.AnonymityJudges = []string{judge.URL}
+            pc.OriginIP = origin
+            proxy := newForwardProxy(t, tt.rewrite)
+            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+            level, err := pc.checkAnonymity(ctx, proxyFor(proxy))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if level != tt.want {
+                t.Errorf("got %s, want %s", level, tt.want)
+            }
+        })
+    }
+}
+
+func TestOriginIPDetection(t *testing.T) {
+    judge := newEchoJudge(t)
+    pc := NewProxyChecker()
+    pc.AnonymityJudges = []string{judge.URL}
+    ip, err := pc.originIP(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ip != "127.0.0.1" {
+        t.Errorf("got origin %q, want 127.0.0.1", ip)
+    }
+}
+
+func TestOriginIPFailureShared(t *testing.T) {
+    var requests int32
+    judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&requests, 1)
+        time.Sleep(100 * time.Millisecond)
+        w.WriteHeader(http.StatusBadGateway)
+    }))
+    defer judge.Close()
+    pc := NewProxyChecker()
+    pc.AnonymityJudges = []string{judge.URL}
+
+    var wg sync.WaitGroup
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if _, err := pc.originIP(context.Background()); err == nil {
+                t.Error("expected the lookup to fail")
+            }
+        }()
+    }
+    wg.Wait()
+    // The failure is remembered instead of being retried by every check.
+    if _, err := pc.originIP(context.Background()); err == nil {
+        t.Error("expected the cached failure")
+    }
+    if got := atomic.LoadInt32(&requests); got != 1 {
+        t.Errorf("judge got %d requests, want 1", got)
+    }
+}
+
+func TestParseJudgeEchoAzenv(t *testing.T) {
+    body := []byte("<pre>\nHTTP_VIA = 1.1 proxy\nHTTP_X_FORWARDED_FOR = 10.0.0.1\nREMOTE_ADDR = 198.51.100.2\n</pre>")
+    echo, err := parseJudgeEcho(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if echo.Origin != "198.51.100.2" || echo.Headers.Get("X-Forwarded-For") != "10.0.0.1" {
+        t.Errorf("unexpected echo %+v", echo)
+    }
+    if got := classifyAnonymity(echo, "10.0.0.1"); got != Transparent {
+        t.Errorf("got %s, want %s", got, Transparent)
+    }
+    if got := classifyAnonymity(echo, "10.0.0.10"); got != Anonymous {
+        t.Errorf("got %s, want %s", got, Anonymous)
+    }
+}
@@ -0,0 +1,247 @@
+package proxychecker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Capability is a set of features a proxy was verified to support.
+type Capability uint
+
+const (
+    // CapHTTPForward means the proxy forwards plain http:// requests.
+    CapHTTPForward Capability = 1 << iota
+    // CapConnect443 means the proxy tunnels connections to port 443, which
+    // for HTTP proxies is the CONNECT method used for https:// requests.
+    CapConnect443
+    // CapConnectAnyPort means the proxy tunnels to ports other than 443.
+    CapConnectAnyPort
+    // CapWebSocket means a WebSocket upgrade succeeded through the proxy.
+    CapWebSocket
+    // CapUDP means the proxy relays UDP datagrams via SOCKS5 UDP ASSOCIATE.
+    CapUDP
+    // CapRemoteDNS means the proxy resolves host names itself. SOCKS proxies
+    // with it can be used as socks4a or socks5h; HTTP proxies get it when a
+    // CONNECT to a host name succeeds.
+    CapRemoteDNS
+)
+
+// CapabilityTargets are the endpoints used to probe the optional
+// capabilities. A capability is only probed when its target is set.
+type CapabilityTargets struct {
+    // ConnectAddr is a host:port on a port other than 443 accepting TCP.
+    ConnectAddr string
+    // WebSocketURL is a ws:// or wss:// endpoint accepting upgrades.
+    WebSocketURL string
+    // UDPEchoAddr is a host:port of a UDP server echoing datagrams back.
+    UDPEchoAddr string
+    // RemoteDNSAddr is a name:port accepting TCP that proxies are asked to
+    // resolve. A name that does not resolve locally proves the proxy
+    // did the lookup.
+    RemoteDNSAddr string
+}
+
+var capabilityNames = []struct {
+    cap  Capability
+    name string
+}{
+    {CapHTTPForward, "http-forward"},
+    {CapConnect443, "connect-443"},
+    {CapConnectAnyPort, "connect-any-port"},
+    {CapWebSocket, "websocket"},
+    {CapUDP, "udp"},
+    {CapRemoteDNS, "remote-dns"},
+}
+
+// Has reports whether c contains every capability in caps.
+func (c Capability) Has(caps Capability) bool {
+    return c&caps == caps
+}
+
+func (c Capability) String() string {
+    var names []string
+    for _, cn := range capabilityNames {
+        if c.Has(cn.cap) {
+            names = append(names, cn.name)
+        }
+    }
+    return strings.Join(names, "|")
+}
+
+// probeCapabilities probes the optional capabilities whose targets are configured.
+func (pc *ProxyChecker) probeCapabilities(ctx context.Context, p Proxy) Capability {
+    var caps Capability
+    targets := pc.CapabilityTargets
+    if targets.ConnectAddr != "" {
+        if conn, err := dialThrough(ctx, p, targets.ConnectAddr, pc.Client.Timeout); err == nil {
+            conn.Close()
+            caps |= CapConnectAnyPort
+        }
+    }
+    if targets.WebSocketURL != "" && pc.probeWebSocket(ctx, p, targets.WebSocketURL) == nil {
+        caps |= CapWebSocket
+    }
+    if targets.UDPEchoAddr != "" && pc.probeUDP(ctx, p, targets.UDPEchoAddr) == nil {
+        caps |= CapUDP
+    }
+    if targets.RemoteDNSAddr != "" && pc.probeRemoteDNS(ctx, p, targets.RemoteDNSAddr) == nil {
+        caps |= CapRemoteDNS
+    }
+    return caps
+}
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// probeWebSocket performs a WebSocket opening handshake through a tunnel.
+func (pc *ProxyChecker) probeWebSocket(ctx context.Context, p Proxy, wsURL string) error {
+    u, err := url.Parse(wsURL)
+    if err != nil {
+        return err
+    }
+    port := u.Port()
+    if port == "" {
+        port = "80"
+        if u.Scheme == "wss" {
+            port = "443"
+        }
+    }
+    conn, err := dialThrough(ctx, p, net.JoinHostPort(u.Hostname(), port), pc.Client.Timeout)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(pc.Client.Timeout))
+    if u.Scheme == "wss" {
+        tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), RootCAs: pc.TLSRootCAs})
+        if err := tlsConn.HandshakeContext(ctx); err != nil {
+            return err
+        }
+        conn = tlsConn
+    }
+
+    nonce := make([]byte, 16)
+    rand.Read(nonce)
+    key := base64.StdEncoding.EncodeToString(nonce)
+    req, err := http.NewRequest("GET", "http://"+u.Host+u.RequestURI(), nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Upgrade", "websocket")
+    req.Header.Set("Connection", "Upgrade")
+    req.Header.Set("Sec-WebSocket-Key", key)
+    req.Header.Set("Sec-WebSocket-Version", "13")
+    if err := req.Write(conn); err != nil {
+        return err
+    }
+    resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusSwitchingProtocols {
+        return fmt.Errorf("websocket upgrade: %s", resp.Status)
+    }
+    sum := sha1.Sum([]byte(key + webSocketGUID))
+    if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+        return errors.New("websocket upgrade: wrong Sec-WebSocket-Accept")
+    }
+    return nil
+}
+
+// probeUDP sends a datagram to echoAddr through a SOCKS5 UDP relay and
+// expects it back unchanged.
+func (pc *ProxyChecker) probeUDP(ctx context.Context, p Proxy, echoAddr string) error {
+    scheme := p.scheme()
+    if scheme != "socks5" && scheme != "socks5h" {
+        return errors.New("UDP relaying needs a SOCKS5 proxy")
+    }
+    dialer := newSocks5Dialer(p.hostPort(), p.Username, p.Password, scheme == "socks5h", pc.Client.Timeout)
+    ctrl, relay, err := dialer.associateUDP(ctx)
+    if err != nil {
+        return err
+    }
+    defer ctrl.Close()
+    conn, err := net.DialUDP("udp", nil, relay)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(pc.Client.Timeout))
+
+    addr, err := dialer.encodeAddr(ctx, echoAddr)
+    if err != nil {
+        return err
+    }
+    payload := make([]byte, 16)
+    rand.Read(payload)
+    datagram := append(append([]byte{0, 0, 0}, addr...), payload...)
+    if _, err := conn.Write(datagram); err != nil {
+        return err
+    }
+    buf := make([]byte, 1500)
+    n, err := conn.Read(buf)
+    if err != nil {
+        return err
+    }
+    reply := bytes.NewReader(buf[:n])
+    if _, err := reply.Seek(3, io.SeekStart); err != nil {
+        return err
+    }
+    if _, err := readSocks5Addr(reply); err != nil {
+        return err
+    }
+    echoed, _ := io.ReadAll(reply)
+    if !bytes.Equal(echoed, payload) {
+        return errors.New("UDP echo payload mismatch")
+    }
+    return nil
+}
+
+// probeRemoteDNS connects to addr through the proxy, leaving the name for
+// the proxy to resolve.
+func (pc *ProxyChecker) probeRemoteDNS(ctx context.Context, p Proxy, addr string) error {
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return err
+    }
+    if net.ParseIP(host) != nil {
+        return errors.New("remote DNS probe needs a host name")
+    }
+    var conn net.Conn
+    switch p.scheme() {
+    case "socks4", "socks4a":
+        conn, err = newSocks4Dialer(p.hostPort(), p.Username, true, pc.Client.Timeout).DialContext(ctx, "tcp", addr)
+    case "socks5", "socks5h":
+        conn, err = newSocks5Dialer(p.hostPort(), p.Username, p.Password, true, pc.Client.Timeout).DialContext(ctx, "tcp", addr)
+    default:
+        conn, err = dialHTTPConnect(ctx, p, addr, pc.Client.Timeout)
+    }
+    if err != nil {
+        return err
+    }
+    return conn.Close()
+}
+
+// GetProxiesWith returns the cached proxies that support every capability in caps.
+func (pc *ProxyChecker) GetProxiesWith(caps Capability) []Proxy {
+    var proxies []Proxy
+    for _, proxy := range pc.GetAllProxies() {
+        if proxy.Capabilities.Has(caps) {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
@@ -0,0 +1,101 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newWebSocketServer(t *testing.T) *httptest.Server {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+            http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+            return
+        }
+        sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + webSocketGUID))
+        conn, buf, err := w.(http.Hijacker).Hijack()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+        buf.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+        buf.Flush()
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func newUDPEcho(t *testing.T) string {
+    conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    go func() {
+        buf := make([]byte, 1500)
+        for {
+            n, from, err := conn.ReadFromUDP(buf)
+            if err != nil {
+                return
+            }
+            conn.WriteToUDP(buf[:n], from)
+        }
+    }()
+    return conn.LocalAddr().String()
+}
+
+func TestProbeCapabilities(t *testing.T) {
+    tcpTarget := listen(t, func(conn net.Conn) { conn.Close() })
+    ws := newWebSocketServer(t)
+    targets := CapabilityTargets{
+        ConnectAddr:  tcpTarget,
+        WebSocketURL: "ws" + strings.TrimPrefix(ws.URL, "http") + "/socket",
+        UDPEchoAddr:  newUDPEcho(t),
+    }
+    socks5 := newSocks5Server(t, "", "")
+
+    tests := []struct {
+        name  string
+        proxy Proxy
+        want  Capability
+    }{
+        {"connect proxy", proxyFor(newConnectProxy(t, nil)), CapConnectAnyPort | CapWebSocket},
+        {"forward only proxy", proxyFor(newForwardProxy(t, nil)), 0},
+        {"socks5", Proxy{Address: socks5.Addr(), Type: "socks5"}, CapConnectAnyPort | CapWebSocket | CapUDP},
+    }
+    for _, tt := range tests {
+        pc := NewProxyChecker()
+        pc.CapabilityTargets = targets
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        got := pc.probeCapabilities(ctx, tt.proxy)
+        cancel()
+        if got != tt.want {
+            t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestGetGoodProxyWith(t *testing.T) {
+    pc := NewProxyChecker()
+    pc.Cache = []Proxy{
+        {Address: "http://1.2.3.4:80", Type: "http", Capabilities: CapHTTPForward},
+        {Address: "socks5://1.2.3.5:1080", Type: "socks5", Capabilities: CapConnect443 | CapUDP},
+    }
+    proxy, err := pc.GetGoodProxyWith(context.Background(), CapUDP)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if proxy.Address != "socks5://1.2.3.5:1080" {
+        t.Errorf("got %+v", proxy)
+    }
+    if len(pc.Cache) != 1 || pc.Cache[0].Type != "http" {
+        t.Errorf("unexpected cache %+v", pc.Cache)
+    }
+}
@@ -0,0 +1,61 @@
+package proxychecker
+
+import "context"
+
+// Checker decides whether a proxy is good. Check returns the proxy, possibly
+// annotated with what was learned about it, or an error explaining why it
+// was rejected. A rejected proxy with its Type set is remembered as bad.
+type Checker interface {
+    Check(ctx context.Context, p Proxy) (Proxy, error)
+}
+
+// CheckerFunc adapts an ordinary function to the Checker interface.
+type CheckerFunc func(ctx context.Context, p Proxy) (Proxy, error)
+
+func (f CheckerFunc) Check(ctx context.Context, p Proxy) (Proxy, error) {
+    return f(ctx, p)
+}
+
+// Chain returns a Checker running checkers in order, each one receiving the
+// proxy returned by the previous one. It stops at the first error.
+func Chain(checkers ...Checker) Checker {
+    return CheckerFunc(func(ctx context.Context, p Proxy) (Proxy, error) {
+        for _, checker := range checkers {
+            var err error
+            if p, err = checker.Check(ctx, p); err != nil {
+                return p, err
+            }
+        }
+        return p, nil
+    })
+}
+
+// defaultChecker runs the built-in checks configured on a ProxyChecker.
+type defaultChecker struct {
+    pc *ProxyChecker
+}
+
+func (c defaultChecker) Check(ctx context.Context, p Proxy) (Proxy, error) {
+    types := proxyTypes
+    if p.Type != "" {
+        types = []string{p.Type}
+    } else if c.pc.SniffProtocols && isValidProxyFormat(p.Address) {
+        if sniffed := c.pc.sniffProtocol(ctx, p); sniffed != "" {
+            types = []string{sniffed}
+        }
+    }
+    return c.pc.runChecks(ctx, p, types)
+}
+
+// DefaultChecker returns the built-in checks, configured by the fields of
+// pc, as a Checker that custom checkers can be chained with.
+func (pc *ProxyChecker) DefaultChecker() Checker {
+    return defaultChecker{pc}
+}
+
+func (pc *ProxyChecker) checker() Checker {
+    if pc.Checker != nil {
+        return pc.Checker
+    }
+    return pc.DefaultChecker()
+}
@@ -0,0 +1,73 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainedChecker(t *testing.T) {
+    judge := newJudge(t)
+    search := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Via") != "" {
+            w.Write([]byte("please solve this captcha"))
+            return
+        }
+        w.Write([]byte("search results"))
+    }))
+    defer search.Close()
+
+    errCaptcha := errors.New("captcha")
+    noCaptcha := CheckerFunc(func(ctx context.Context, p Proxy) (Proxy, error) {
+        transport, err := p.Transport()
+        if err != nil {
+            return p, err
+        }
+        defer transport.CloseIdleConnections()
+        resp, err := (&http.Client{Transport: transport}).Get(search.URL)
+        if err != nil {
+            return p, err
+        }
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(resp.Body)
+        if strings.Contains(string(body), "captcha") {
+            return p, errCaptcha
+        }
+        return p, nil
+    })
+
+    tests := []struct {
+        name    string
+        rewrite func(*http.Request)
+        wantErr error
+    }{
+        {"clean", nil, nil},
+        {"captcha", func(r *http.Request) { r.Header.Set("Via", "1.1 proxy") }, errCaptcha},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pc := NewProxyChecker()
+            pc.Judges = []Judge{judge}
+            pc.Checker = Chain(pc.DefaultChecker(), noCaptcha)
+            proxy := proxyFor(newForwardProxy(t, tt.rewrite))
+            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+
+            result, err := pc.checker().Check(ctx, proxy)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("got error %v, want %v", err, tt.wantErr)
+            }
+            if result.Timings.Total == 0 {
+                t.Error("default checks did not run before the custom one")
+            }
+            if _, valid := pc.record(proxy, result, err); valid != (tt.wantErr == nil) {
+                t.Errorf("got valid=%v", valid)
+            }
+        })
+    }
+}
@@ -0,0 +1,74 @@
+package proxychecker
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// newLimitFixture returns a checker whose judge is local, three good proxies
+// and five that accept connections but never answer.
+func newLimitFixture(t *testing.T) (*ProxyChecker, []Proxy) {
+    judge := newJudge(t)
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{judge}
+    pc.PrefilterTimeout = 0
+    t.Cleanup(func() { pc.Close() })
+
+    var proxies []Proxy
+    for i := 0; i < 5; i++ {
+        silent := listen(t, func(conn net.Conn) {
+            time.Sleep(10 * time.Second)
+            conn.Close()
+        })
+        proxies = append(proxies, Proxy{Address: silent, Type: "http"})
+    }
+    for i := 0; i < 3; i++ {
+        proxies = append(proxies, proxyFor(newForwardProxy(t, nil)))
+    }
+    return pc, proxies
+}
+
+func TestCheckLimitStopsRun(t *testing.T) {
+    pc, proxies := newLimitFixture(t)
+    pc.CheckLimit = 2
+    start := time.Now()
+    var good int
+    for result := range pc.StreamProxies(context.Background(), proxies) {
+        if result.Good {
+            good++
+        } else {
+            t.Errorf("unexpected result for a cancelled check: %+v", result)
+        }
+    }
+    if elapsed := time.Since(start); elapsed > 3*time.Second {
+        t.Errorf("run took %s, it should stop after %d good proxies", elapsed, pc.CheckLimit)
+    }
+    if good < 2 {
+        t.Errorf("got %d good proxies, want at least 2", good)
+    }
+}
+
+func TestGetGoodProxyReturnsFirst(t *testing.T) {
+    saved := urls
+    urls = nil
+    t.Cleanup(func() { urls = saved })
+    pc, proxies := newLimitFixture(t)
+    pc.CheckLimit = 0
+    for _, p := range proxies {
+        if err := pc.AddProxies(p.URL()); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+    proxy, err := pc.GetGoodProxy(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if proxy.Address == "" {
+        t.Fatal("no proxy returned")
+    }
+}
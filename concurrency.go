@@ -0,0 +1,224 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+    // fdsPerCheck is roughly how many descriptors one check holds at once:
+    // a connection per protocol tried plus a spare for the follow-up probes.
+    fdsPerCheck = 2 * 3
+    // fdReserve is left for everything else the process has open.
+    fdReserve      = 64
+    adjustInterval = time.Second
+)
+
+// ConcurrencyStats is a live view of the checks of the current or last run.
+type ConcurrencyStats struct {
+    // Limit is the number of checks currently allowed to run at once.
+    Limit    int
+    InFlight int
+    // Completed counts finished checks, DialErrors those that failed to
+    // connect and ResourceErrors those that ran out of local descriptors
+    // or ports.
+    Completed       int64
+    DialErrors      int64
+    ResourceErrors  int64
+    ChecksPerSecond float64
+}
+
+// concurrencyController hands out check slots. With adaptive set the limit
+// grows while throughput improves and shrinks on resource exhaustion or a
+// jump in dial errors that costs throughput.
+type concurrencyController struct {
+    mu       sync.Mutex
+    wake     chan struct{}
+    limit    int
+    max      int
+    inFlight int
+    adaptive bool
+    interval time.Duration
+    nextSlot time.Time
+
+    windowStart      time.Time
+    windowDone       int
+    windowDialErrors int
+    windowResource   bool
+    prevRate         float64
+    prevErrorRate    float64
+
+    completed      int64
+    dialErrors     int64
+    resourceErrors int64
+    rate           float64
+}
+
+func (pc *ProxyChecker) newConcurrencyController() *concurrencyController {
+    limit := pc.ConcurrencyLimit
+    if limit <= 0 {
+        limit = 1
+    }
+    max := limit
+    if pc.AdaptiveConcurrency {
+        max = pc.MaxConcurrency
+        if max <= 0 {
+            max = 10 * limit
+        }
+    }
+    if fds := fdLimit(); fds > 0 {
+        if byFDs := (fds - fdReserve) / fdsPerCheck; byFDs < max {
+            max = byFDs
+        }
+    }
+    if max < 1 {
+        max = 1
+    }
+    if limit > max {
+        limit = max
+    }
+    c := &concurrencyController{
+        wake:        make(chan struct{}),
+        limit:       limit,
+        max:         max,
+        adaptive:    pc.AdaptiveConcurrency,
+        windowStart: time.Now(),
+    }
+    if pc.ChecksPerSecond > 0 {
+        c.interval = time.Duration(float64(time.Second) / pc.ChecksPerSecond)
+    }
+    return c
+}
+
+// acquire blocks until a check may start or ctx is done.
+func (c *concurrencyController) acquire(ctx context.Context) error {
+    for {
+        c.mu.Lock()
+        if c.inFlight < c.limit {
+            c.inFlight++
+            c.mu.Unlock()
+            break
+        }
+        wake := c.wake
+        c.mu.Unlock()
+        select {
+        case <-wake:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+    if err := c.waitRate(ctx); err != nil {
+        c.release(nil)
+        return err
+    }
+    return nil
+}
+
+// waitRate spaces check starts ChecksPerSecond apart.
+func (c *concurrencyController) waitRate(ctx context.Context) error {
+    if c.interval <= 0 {
+        return nil
+    }
+    c.mu.Lock()
+    now := time.Now()
+    if c.nextSlot.Before(now) {
+        c.nextSlot = now
+    }
+    wait := c.nextSlot.Sub(now)
+    c.nextSlot = c.nextSlot.Add(c.interval)
+    c.mu.Unlock()
+    if wait <= 0 {
+        return nil
+    }
+    timer := time.NewTimer(wait)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// release frees the slot of a finished check whose outcome was err.
+func (c *concurrencyController) release(err error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.inFlight--
+    c.observe(err, time.Now())
+    close(c.wake)
+    c.wake = make(chan struct{})
+}
+
+// observe accounts for a finished check and adjusts the limit once per
+// adjustInterval. c.mu must be held.
+func (c *concurrencyController) observe(err error, now time.Time) {
+    c.completed++
+    c.windowDone++
+    if isResourceError(err) {
+        c.resourceErrors++
+        c.windowResource = true
+    } else if isDialError(err) {
+        c.dialErrors++
+        c.windowDialErrors++
+    }
+    elapsed := now.Sub(c.windowStart)
+    if elapsed < adjustInterval {
+        return
+    }
+    rate := float64(c.windowDone) / elapsed.Seconds()
+    errorRate := float64(c.windowDialErrors) / float64(c.windowDone)
+    c.rate = rate
+    if c.adaptive {
+        switch {
+        case c.windowResource:
+            c.limit /= 2
+        case c.prevRate > 0 && errorRate > c.prevErrorRate+0.2 && rate < c.prevRate:
+            c.limit -= c.limit / 4
+        case rate >= c.prevRate*0.9:
+            c.limit += c.limit/10 + 1
+        }
+        if c.limit < 1 {
+            c.limit = 1
+        }
+        if c.limit > c.max {
+            c.limit = c.max
+        }
+    }
+    c.prevRate, c.prevErrorRate = rate, errorRate
+    c.windowStart, c.windowDone, c.windowDialErrors, c.windowResource = now, 0, 0, false
+}
+
+func (c *concurrencyController) stats() ConcurrencyStats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return ConcurrencyStats{
+        Limit:           c.limit,
+        InFlight:        c.inFlight,
+        Completed:       c.completed,
+        DialErrors:      c.dialErrors,
+        ResourceErrors:  c.resourceErrors,
+        ChecksPerSecond: c.rate,
+    }
+}
+
+// isDialError reports whether err is a failure to connect to the proxy.
+// net/http reports those for HTTP proxies as "proxyconnect" errors.
+func isDialError(err error) bool {
+    var opErr *net.OpError
+    return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// ConcurrencyStats returns live statistics of the running or last check run.
+func (pc *ProxyChecker) ConcurrencyStats() ConcurrencyStats {
+    pc.controllerLock.Lock()
+    c := pc.controller
+    pc.controllerLock.Unlock()
+    if c == nil {
+        return ConcurrencyStats{}
+    }
+    return c.stats()
+}
@@ -0,0 +1,70 @@
+package proxychecker
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimitBlocks(t *testing.T) {
+    pc := NewProxyChecker()
+    pc.ConcurrencyLimit = 1
+    c := pc.newConcurrencyController()
+    ctx := context.Background()
+    if err := c.acquire(ctx); err != nil {
+        t.Fatal(err)
+    }
+    blocked, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+    defer cancel()
+    if err := c.acquire(blocked); err == nil {
+        t.Fatal("second acquire must block while the only slot is taken")
+    }
+    go func() {
+        time.Sleep(20 * time.Millisecond)
+        c.release(nil)
+    }()
+    if err := c.acquire(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if stats := c.stats(); stats.InFlight != 1 || stats.Completed != 1 {
+        t.Errorf("unexpected stats %+v", stats)
+    }
+}
+
+func TestChecksPerSecond(t *testing.T) {
+    pc := NewProxyChecker()
+    pc.ChecksPerSecond = 50
+    c := pc.newConcurrencyController()
+    start := time.Now()
+    for i := 0; i < 6; i++ {
+        if err := c.acquire(context.Background()); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // The first check starts at once, the other five 20ms apart.
+    if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+        t.Errorf("6 checks at 50/s started within %s", elapsed)
+    }
+}
+
+func TestDialErrorsCounted(t *testing.T) {
+    c := NewProxyChecker().newConcurrencyController()
+    // Nothing listens on port 1, so each request fails connecting to the proxy.
+    for _, scheme := range []string{"http", "socks5"} {
+        transport, err := newProxyTransport(&url.URL{Scheme: scheme, Host: "127.0.0.1:1"}, time.Second)
+        if err != nil {
+            t.Fatal(err)
+        }
+        _, err = (&http.Client{Transport: transport}).Get("http://example.com/")
+        if err == nil {
+            t.Fatalf("%s: request through a closed port succeeded", scheme)
+        }
+        c.observe(err, time.Now())
+        if got := c.stats().DialErrors; got == 0 {
+            t.Errorf("%s: %v was not counted as a dial error", scheme, err)
+        }
+        c.dialErrors = 0
+    }
+}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package proxychecker
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveConcurrency(t *testing.T) {
+    pc := NewProxyChecker()
+    pc.ConcurrencyLimit = 10
+    pc.MaxConcurrency = 12
+    pc.AdaptiveConcurrency = true
+    c := pc.newConcurrencyController()
+    if c.limit != 10 {
+        t.Fatalf("got initial limit %d, want 10", c.limit)
+    }
+
+    // window spreads n outcomes evenly over one adjustment interval.
+    now := c.windowStart
+    window := func(n int, err error) {
+        start := now
+        for i := 1; i <= n; i++ {
+            c.observe(err, start.Add(adjustInterval*time.Duration(i)/time.Duration(n)))
+        }
+        now = start.Add(adjustInterval)
+    }
+
+    // Steady throughput grows the limit up to the maximum.
+    for i := 0; i < 5; i++ {
+        window(20, nil)
+    }
+    if c.limit != 12 {
+        t.Errorf("got limit %d after steady windows, want 12", c.limit)
+    }
+
+    // Running out of descriptors halves it.
+    window(1, fmt.Errorf("dial: %w", &net.OpError{Op: "dial", Err: os.NewSyscallError("socket", syscall.EMFILE)}))
+    if c.limit != 6 {
+        t.Errorf("got limit %d after EMFILE, want 6", c.limit)
+    }
+
+    // Dial errors jumping while throughput drops shrink it as well.
+    window(20, nil)
+    before := c.limit
+    window(10, &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})
+    stats := c.stats()
+    if stats.Limit >= before {
+        t.Errorf("got limit %d after dial errors, want it below %d", stats.Limit, before)
+    }
+    if stats.ResourceErrors != 1 || stats.DialErrors != 10 {
+        t.Errorf("unexpected stats %+v", stats)
+    }
+}
@@ -1,13 +1,58 @@
 package proxychecker
 
 import (
+	"crypto/x509"
 	"net/http"
+	"regexp"
 	"sync"
+	"time"
 )
 
 type Proxy struct {
     Address string
     Type    string
+    // Username and Password authenticate against the proxy, using HTTP Basic
+    // for HTTP proxies, RFC 1929 for SOCKS5 and the user ID for SOCKS4.
+    Username string
+    Password string
+    Timings Timings
+    // SuccessRatio is the share of the ProxyChecker.Samples requests that
+    // passed and LatencySpread the gap between the slowest and the fastest
+    // of them. Both are zero when sampling is disabled.
+    SuccessRatio  float64
+    LatencySpread time.Duration
+    Anonymity AnonymityLevel
+    Capabilities Capability
+    // TLSTampered is set when the proxy was caught intercepting TLS.
+    TLSTampered bool
+    // ExitIP is the address judges saw the proxy's requests coming from.
+    ExitIP string
+    // Rotating is set when repeated requests left through different exit IPs.
+    Rotating bool
+    // Location and ExitLocation are where the proxy address and ExitIP are
+    // registered according to ProxyChecker.GeoIP. Both are zero without it.
+    Location     Location
+    ExitLocation Location
+    // Throughput is the download rate in bytes per second measured against
+    // ProxyChecker.ThroughputURL, or zero when not measured.
+    Throughput float64
+    // Injected is set when the proxy altered a response body in transit.
+    Injected bool
+    // Targets holds the result for every ProxyChecker.Targets entry. It is
+    // nil when no targets are configured.
+    Targets *TargetReport
+    // Tampering is what the proxy changed about our request. It is nil
+    // unless ProxyChecker.AnalyzeTampering is set.
+    Tampering *TamperReport
+}
+
+// Timings holds how long each phase of a successful check request took.
+// FirstByte and Total are measured from the start of the request.
+type Timings struct {
+    Connect      time.Duration
+    TLSHandshake time.Duration
+    FirstByte    time.Duration
+    Total        time.Duration
 }
 
 type ProxyChecker struct {
@@ -16,25 +61,154 @@ type ProxyChecker struct {
     Client     *http.Client
     Headers    map[string]string
     Proxies    sync.Map
+    // CheckLimit stops a refresh, cancelling the checks still running, once
+    // that many good proxies were found. Zero checks every proxy.
     CheckLimit int
 	ConcurrencyLimit int
+    // AdaptiveConcurrency starts at ConcurrencyLimit and adjusts the number
+    // of concurrent checks, up to MaxConcurrency (default ten times
+    // ConcurrencyLimit), to throughput and dial errors. Either way the limit
+    // is capped by what the file descriptor limit allows.
+    AdaptiveConcurrency bool
+    MaxConcurrency      int
+    // ChecksPerSecond, when positive, limits how fast checks are started.
+    ChecksPerSecond float64
+    // Checker validates scraped proxies. When nil DefaultChecker is used.
+    Checker Checker
+    // Judges are the targets proxies are checked against. When empty the
+    // built-in judges are used.
+    Judges []Judge
+    // CheckAnonymity classifies every validated proxy as transparent,
+    // anonymous or elite using the echo judges in AnonymityJudges.
+    CheckAnonymity  bool
+    AnonymityJudges []string
+    // OriginIP is our own public IP. When empty it is looked up through a judge.
+    OriginIP string
+
+    // Targets, when set, replace the judges: every proxy is tried against
+    // them and those failing all of them are kept out of the pool.
+    Targets []Target
+
+    // Samples, when above one, is how many requests each proxy has to answer,
+    // spread across different judges. Proxies whose success ratio falls below
+    // MinSuccessRatio are kept out of the pool.
+    Samples         int
+    MinSuccessRatio float64
+
+    // DetectTLSTampering compares the certificate chain an https judge
+    // presents through each proxy with TLSPins or with the chain it presents
+    // directly. Proxies that intercept TLS are excluded from the pool.
+    DetectTLSTampering bool
+    // TLSPins maps a judge host name to the base64 SHA-256 SPKI pins one of
+    // which must appear in its chain, see SPKIPin.
+    TLSPins map[string][]string
+    // TLSRootCAs verifies judge certificates. Nil means the system roots.
+    TLSRootCAs *x509.CertPool
+
+    // PrefilterTimeout enables a TCP connect stage that discards proxies
+    // which are not listening before any protocol check. Zero disables it.
+    PrefilterTimeout     time.Duration
+    PrefilterConcurrency int
+    // PrefilterGreeting additionally sends a SOCKS5 greeting, then a SOCKS4
+    // request if that is refused, and discards ports that close the
+    // connection on both instead of answering or waiting.
+    PrefilterGreeting bool
+
+    // SniffProtocols identifies the protocol of proxies without a Type from
+    // the reply to a greeting and then checks only that protocol, instead
+    // of trying every protocol in parallel. Unidentified proxies still get
+    // every protocol tried. SniffTimeout defaults to Client.Timeout.
+    SniffProtocols bool
+    SniffTimeout   time.Duration
+
+    // RotationSamples, when above one, is how many times each validated proxy
+    // asks ExitIPJudges for its exit IP to tell rotating gateways from
+    // static proxies.
+    RotationSamples int
+    ExitIPJudges    []string
+
+    // GeoIP, when set, locates every validated proxy and its exit IP
+    // offline, see OpenGeoIPDatabase.
+    GeoIP *GeoIPDatabase
+
+    // CapabilityTargets enables probing for CONNECT to other ports,
+    // WebSocket upgrades and SOCKS5 UDP relaying.
+    CapabilityTargets CapabilityTargets
+
+    // AnalyzeTampering compares the request an echo judge from
+    // TamperingJudges receives through each proxy with the one it receives
+    // directly and attaches the differences to the proxy.
+    AnalyzeTampering bool
+    TamperingJudges  []string
+
+    // IntegrityChecks are payloads with known hashes fetched through each
+    // proxy. Proxies returning a different body are flagged as Injected and,
+    // unless AllowInjecting is set, kept out of the pool.
+    IntegrityChecks []IntegrityCheck
+    AllowInjecting  bool
+
+    // ThroughputURL enables a download test through each validated proxy.
+    // At most ThroughputMaxBytes (default 5 MiB) are read within
+    // ThroughputBudget (default 30s).
+    ThroughputURL      string
+    ThroughputMaxBytes int64
+    ThroughputBudget   time.Duration
+
+    seeds            []Proxy
+    originLock       sync.Mutex
+    originLookup     *originLookup
+    tlsLock          sync.Mutex
+    directTLSPins    map[string]map[string]bool
+    tamperingLock    sync.Mutex
+    directEchoes     map[string]judgeEcho
+    controllerLock   sync.Mutex
+    controller       *concurrencyController
+    runStats         *runStats
+    cacheAdded       chan struct{}
+    refreshLock      sync.Mutex
+    refreshing       *refreshRun
+    lifeLock         sync.Mutex
+    closed           chan struct{}
+    running          sync.WaitGroup
 }
 
 var (
-	httpServers = [13]string{
+	// defaultJudges are used when ProxyChecker.Judges is empty. Each one
+	// requires content only the genuine site serves; the plain http:// ones
+	// tell whether a proxy forwards requests itself instead of only tunnelling.
+	defaultJudges = []Judge{
+        {URL: "https://www.cloudflare.com/cdn-cgi/trace", Contains: "ip=", MaxBodySize: 4 << 10},
+        {URL: "https://www.google.com", Match: regexp.MustCompile(`(?i)google`), MaxBodySize: 4 << 20},
+        {URL: "https://www.youtube.com", Match: regexp.MustCompile(`(?i)youtube`), MaxBodySize: 4 << 20},
+        {URL: "https://www.facebook.com", Match: regexp.MustCompile(`(?i)facebook`), MaxBodySize: 4 << 20},
+        {URL: "https://www.amazon.com", Match: regexp.MustCompile(`(?i)amazon`), MaxBodySize: 4 << 20},
+        {URL: "https://www.instagram.com", Match: regexp.MustCompile(`(?i)instagram`), MaxBodySize: 4 << 20},
+        {URL: "https://www.whatsapp.com", Match: regexp.MustCompile(`(?i)whatsapp`), MaxBodySize: 4 << 20},
+        {URL: "https://www.linkedin.com", Match: regexp.MustCompile(`(?i)linkedin`), MaxBodySize: 4 << 20},
+        {URL: "https://www.bing.com", Match: regexp.MustCompile(`(?i)bing`), MaxBodySize: 4 << 20},
+        {URL: "https://aws.amazon.com", Match: regexp.MustCompile(`(?i)amazon web services`), MaxBodySize: 4 << 20},
+        {URL: "https://www.x.com", Match: regexp.MustCompile(`(?i)twitter|x\.com`), MaxBodySize: 4 << 20},
+        {URL: "https://www.alibaba.com", Match: regexp.MustCompile(`(?i)alibaba`), MaxBodySize: 4 << 20},
+        {URL: "https://www.apple.com", Match: regexp.MustCompile(`(?i)apple`), MaxBodySize: 4 << 20},
+        {URL: "http://www.cloudflare.com/cdn-cgi/trace", Contains: "ip=", MaxBodySize: 4 << 10},
+        {URL: "http://httpbin.org/get", Contains: `"origin"`, MaxBodySize: 64 << 10},
+        {URL: "http://example.com", Contains: "Example Domain", MaxBodySize: 64 << 10},
+    }
+	// exitIPJudges report the address a request came from.
+	exitIPJudges = []string{
         "https://www.cloudflare.com/cdn-cgi/trace",
-        "https://www.google.com",
-        "https://www.youtube.com",
-        "https://www.facebook.com",
-        "https://www.amazon.com",
-        "https://www.instagram.com",
-        "https://www.whatsapp.com",
-        "https://www.linkedin.com",
-        "https://www.bing.com",
-        "https://aws.amazon.com",
-        "https://www.x.com",
-        "https://www.alibaba.com",
-        "https://www.apple.com",
+        "https://api.ipify.org",
+        "http://httpbin.org/ip",
+    }
+	// tamperingJudges echo the method, URL and headers they received.
+	tamperingJudges = []string{
+        "http://httpbin.org/anything",
+    }
+	// anonymityJudges echo the headers and remote address they received. They
+	// are plain http so that proxies get the chance to add their own headers.
+	anonymityJudges = []string{
+        "http://httpbin.org/get",
+        "http://azenv.net/",
     }
 	urls = []string{
 		"https://biskutliat.blogspot.com/",
@@ -0,0 +1,121 @@
+package proxychecker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var errNoExitIP = errors.New("judge did not report an exit IP")
+
+var traceIPRegexp = regexp.MustCompile(`(?m)^ip=(\S+)$`)
+
+// extractIP returns the client address a judge reported in its body, e.g. the
+// ip= line of cloudflare's cdn-cgi/trace, the origin of an httpbin style
+// echo, or a body that is nothing but an address. It returns "" otherwise.
+func extractIP(body []byte) string {
+    if m := traceIPRegexp.FindSubmatch(body); m != nil && net.ParseIP(string(m[1])) != nil {
+        return string(m[1])
+    }
+    trimmed := bytes.TrimSpace(body)
+    if ip := net.ParseIP(string(trimmed)); ip != nil {
+        return ip.String()
+    }
+    if bytes.HasPrefix(trimmed, []byte("{")) {
+        if echo, err := parseJudgeEcho(trimmed); err == nil {
+            origin := strings.TrimSpace(strings.Split(echo.Origin, ",")[0])
+            if net.ParseIP(origin) != nil {
+                return origin
+            }
+        }
+    }
+    return ""
+}
+
+// sampleExitIPs asks the exit IP judges for our address n times through the
+// proxy, each time over a new connection so that gateways rotating their exit
+// per connection are noticed.
+func (pc *ProxyChecker) sampleExitIPs(ctx context.Context, p Proxy, n int) ([]string, error) {
+    transport, err := pc.newTransport(p)
+    if err != nil {
+        return nil, err
+    }
+    transport.DisableKeepAlives = true
+    defer transport.CloseIdleConnections()
+    client := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+    }
+    judges := pc.ExitIPJudges
+    if len(judges) == 0 {
+        judges = exitIPJudges
+    }
+
+    var ips []string
+    var lastErr error
+    for i := 0; i < n; i++ {
+        ip, err := pc.fetchExitIP(ctx, client, judges[i%len(judges)])
+        if err != nil {
+            lastErr = err
+            continue
+        }
+        ips = append(ips, ip)
+    }
+    if len(ips) == 0 {
+        return nil, lastErr
+    }
+    return ips, nil
+}
+
+func (pc *ProxyChecker) fetchExitIP(ctx context.Context, client *http.Client, judge string) (string, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", judge, nil)
+    if err != nil {
+        return "", err
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+    if err != nil {
+        return "", err
+    }
+    ip := extractIP(body)
+    if resp.StatusCode != http.StatusOK || ip == "" {
+        return "", errNoExitIP
+    }
+    return ip, nil
+}
+
+func distinct(values []string) []string {
+    seen := map[string]bool{}
+    var unique []string
+    for _, value := range values {
+        if !seen[value] {
+            seen[value] = true
+            unique = append(unique, value)
+        }
+    }
+    return unique
+}
+
+// GroupByExitIP returns the cached proxies keyed by the exit IP they were
+// seen with. Proxies whose exit IP is unknown are left out.
+func (pc *ProxyChecker) GroupByExitIP() map[string][]Proxy {
+    groups := map[string][]Proxy{}
+    for _, proxy := range pc.GetAllProxies() {
+        if proxy.ExitIP != "" {
+            groups[proxy.ExitIP] = append(groups[proxy.ExitIP], proxy)
+        }
+    }
+    return groups
+}
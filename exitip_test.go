@@ -0,0 +1,72 @@
+package proxychecker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExtractIP(t *testing.T) {
+    tests := []struct {
+        body string
+        want string
+    }{
+        {"fl=123\nh=www.cloudflare.com\nip=198.51.100.7\nts=1\n", "198.51.100.7"},
+        {"ip=2001:db8::7\n", "2001:db8::7"},
+        {`{"origin": "198.51.100.7, 10.0.0.1"}`, "198.51.100.7"},
+        {" 198.51.100.7\n", "198.51.100.7"},
+        {"<html>ip=nothing</html>", ""},
+    }
+    for _, tt := range tests {
+        if got := extractIP([]byte(tt.body)); got != tt.want {
+            t.Errorf("extractIP(%q) = %q, want %q", tt.body, got, tt.want)
+        }
+    }
+}
+
+func TestExitIPAndRotation(t *testing.T) {
+    var requests int32
+    static := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, "ip=198.51.100.7\n")
+    }))
+    defer static.Close()
+    rotating := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n := atomic.AddInt32(&requests, 1)
+        fmt.Fprintf(w, "ip=198.51.100.%d\n", n)
+    }))
+    defer rotating.Close()
+
+    tests := []struct {
+        name     string
+        judge    string
+        rotating bool
+    }{
+        {"static", static.URL, false},
+        {"rotating", rotating.URL, true},
+    }
+    for _, tt := range tests {
+        pc := NewProxyChecker()
+        pc.Judges = []Judge{{URL: tt.judge, Contains: "ip="}}
+        pc.ExitIPJudges = []string{tt.judge}
+        pc.RotationSamples = 3
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        result, valid := pc.checkProxy(ctx, proxyFor(newForwardProxy(t, nil)), []string{"http"})
+        cancel()
+        if !valid {
+            t.Fatalf("%s: expected proxy to pass", tt.name)
+        }
+        if result.ExitIP == "" {
+            t.Errorf("%s: exit IP not recorded", tt.name)
+        }
+        if result.Rotating != tt.rotating {
+            t.Errorf("%s: rotating = %v, want %v", tt.name, result.Rotating, tt.rotating)
+        }
+        if groups := pc.GroupByExitIP(); len(groups[result.ExitIP]) != 1 {
+            t.Errorf("%s: unexpected groups %v", tt.name, groups)
+        }
+    }
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package proxychecker
+
+// fdLimit returns 0 where the descriptor limit cannot be queried.
+func fdLimit() int {
+    return 0
+}
+
+// isResourceError reports false where local resource exhaustion can't be
+// told apart from other errors.
+func isResourceError(err error) bool {
+    return false
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package proxychecker
+
+import (
+	"errors"
+	"syscall"
+)
+
+// fdLimit returns the soft limit on open file descriptors, or 0 if unknown.
+func fdLimit() int {
+    var rlimit syscall.Rlimit
+    if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+        return 0
+    }
+    if rlimit.Cur > 1<<20 {
+        return 1 << 20
+    }
+    return int(rlimit.Cur)
+}
+
+// isResourceError reports whether err means we ran out of descriptors,
+// ephemeral ports or buffers rather than the proxy being at fault.
+func isResourceError(err error) bool {
+    return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+        errors.Is(err, syscall.EADDRNOTAVAIL) || errors.Is(err, syscall.ENOBUFS)
+}
@@ -0,0 +1,138 @@
+package proxychecker
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+)
+
+// Location is where an IP address is registered according to a GeoIP
+// database. Country is the ISO 3166-1 code, Region and City are the English
+// names. Fields the database does not know are empty.
+type Location struct {
+    Country string
+    Region  string
+    City    string
+}
+
+// Matches reports whether l is within want. Empty fields of want match
+// anything and the others are compared case-insensitively, so
+// Location{Country: "DE"} matches every location in Germany.
+func (l Location) Matches(want Location) bool {
+    return matchField(l.Country, want.Country) && matchField(l.Region, want.Region) && matchField(l.City, want.City)
+}
+
+func matchField(have, want string) bool {
+    return want == "" || strings.EqualFold(have, want)
+}
+
+// GeoIPDatabase is a MaxMind DB file, such as GeoLite2-City.mmdb or
+// GeoLite2-Country.mmdb, loaded into memory for offline lookups.
+type GeoIPDatabase struct {
+    reader *mmdbReader
+}
+
+// OpenGeoIPDatabase loads the MaxMind DB file at path.
+func OpenGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+    buf, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    reader, err := newMMDBReader(buf)
+    if err != nil {
+        return nil, err
+    }
+    return &GeoIPDatabase{reader: reader}, nil
+}
+
+// Lookup returns the location of ip. It reports false when the database has
+// no record for it.
+func (db *GeoIPDatabase) Lookup(ip net.IP) (Location, bool) {
+    record, err := db.reader.lookup(ip)
+    if err != nil || record == nil {
+        return Location{}, false
+    }
+    var loc Location
+    loc.Country, _ = mmdbPath(record, "country", "iso_code").(string)
+    if loc.Country == "" {
+        // Anonymous proxies and satellite providers often only have this.
+        loc.Country, _ = mmdbPath(record, "registered_country", "iso_code").(string)
+    }
+    if subdivisions, ok := mmdbPath(record, "subdivisions").([]interface{}); ok && len(subdivisions) > 0 {
+        loc.Region, _ = mmdbPath(subdivisions[0], "names", "en").(string)
+    }
+    loc.City, _ = mmdbPath(record, "city", "names", "en").(string)
+    return loc, true
+}
+
+// mmdbPath follows keys through nested maps of a decoded record.
+func mmdbPath(v interface{}, keys ...string) interface{} {
+    for _, key := range keys {
+        m, ok := v.(map[string]interface{})
+        if !ok {
+            return nil
+        }
+        v = m[key]
+    }
+    return v
+}
+
+// locate sets the entry and exit locations of a validated proxy.
+func (pc *ProxyChecker) locate(ctx context.Context, p Proxy) Proxy {
+    if host, _, err := net.SplitHostPort(p.hostPort()); err == nil {
+        ip := net.ParseIP(host)
+        if ip == nil {
+            if addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host); err == nil && len(addrs) > 0 {
+                ip = addrs[0].IP
+            }
+        }
+        if ip != nil {
+            p.Location, _ = pc.GeoIP.Lookup(ip)
+        }
+    }
+    if ip := net.ParseIP(p.ExitIP); ip != nil {
+        p.ExitLocation, _ = pc.GeoIP.Lookup(ip)
+    }
+    return p
+}
+
+// location is where traffic through p appears to come from: the exit
+// location, or the entry location when the exit IP is unknown.
+func (p Proxy) location() Location {
+    if p.ExitIP != "" {
+        return p.ExitLocation
+    }
+    return p.Location
+}
+
+// GetProxiesIn returns the cached proxies whose traffic leaves within loc.
+// The exit location is used, or the entry location when the exit IP is
+// unknown; see Location.Matches.
+func (pc *ProxyChecker) GetProxiesIn(loc Location) []Proxy {
+    var proxies []Proxy
+    for _, proxy := range pc.GetAllProxies() {
+        if proxy.location().Matches(loc) {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
+
+// GetGoodProxyIn is like GetGoodProxy but only hands out a proxy whose
+// traffic leaves within loc.
+func (pc *ProxyChecker) GetGoodProxyIn(ctx context.Context, loc Location) (Proxy, error) {
+    return pc.takeProxy(ctx, func(p Proxy) bool { return p.location().Matches(loc) })
+}
+
+// GroupByCountry groups the cached proxies by the country code their
+// traffic leaves from. Proxies without a known country are left out.
+func (pc *ProxyChecker) GroupByCountry() map[string][]Proxy {
+    groups := map[string][]Proxy{}
+    for _, proxy := range pc.GetAllProxies() {
+        if country := proxy.location().Country; country != "" {
+            groups[country] = append(groups[country], proxy)
+        }
+    }
+    return groups
+}
@@ -0,0 +1,338 @@
+package proxychecker
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mmdbNode is a search tree node of a test database. Each side holds either
+// a child node or the index of a record.
+type mmdbNode struct {
+    child  [2]*mmdbNode
+    record [2]int
+    index  int
+}
+
+// writeTestMMDB writes a MaxMind DB mapping the networks in records, which
+// must not overlap, to their records and returns its path. IPv6 networks are
+// left out of IPv4 databases.
+func writeTestMMDB(t *testing.T, ipVersion, recordSize int, records map[string]map[string]interface{}) string {
+    t.Helper()
+    root := &mmdbNode{record: [2]int{-1, -1}}
+    var data []byte
+    var offsets []int
+    for cidr, record := range records {
+        _, network, err := net.ParseCIDR(cidr)
+        if err != nil {
+            t.Fatal(err)
+        }
+        ones, _ := network.Mask.Size()
+        ip := network.IP
+        if ipVersion == 6 {
+            // IPv4 networks go under ::/96, not ::ffff:0:0/96.
+            if v4 := ip.To4(); v4 != nil {
+                ones += 96
+                ip = append(make(net.IP, 12), v4...)
+            }
+        } else if ip = ip.To4(); ip == nil {
+            continue
+        }
+        offsets = append(offsets, len(data))
+        data = append(data, encodeMMDB(record)...)
+        node := root
+        for i := 0; i < ones; i++ {
+            bit := ip[i/8] >> (7 - i%8) & 1
+            if i == ones-1 {
+                node.record[bit] = len(offsets) - 1
+                break
+            }
+            if node.child[bit] == nil {
+                node.child[bit] = &mmdbNode{record: [2]int{-1, -1}}
+            }
+            node = node.child[bit]
+        }
+    }
+
+    var nodes []*mmdbNode
+    for queue := []*mmdbNode{root}; len(queue) > 0; queue = queue[1:] {
+        queue[0].index = len(nodes)
+        nodes = append(nodes, queue[0])
+        for _, child := range queue[0].child {
+            if child != nil {
+                queue = append(queue, child)
+            }
+        }
+    }
+    var tree []byte
+    for _, node := range nodes {
+        var values [2]uint32
+        for bit := range values {
+            switch {
+            case node.child[bit] != nil:
+                values[bit] = uint32(node.child[bit].index)
+            case node.record[bit] >= 0:
+                values[bit] = uint32(len(nodes) + 16 + offsets[node.record[bit]])
+            default:
+                values[bit] = uint32(len(nodes))
+            }
+        }
+        l, r := values[0], values[1]
+        switch recordSize {
+        case 24:
+            tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+        case 28:
+            tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>20&0xf0|r>>24&0x0f), byte(r>>16), byte(r>>8), byte(r))
+        default:
+            tree = append(tree, byte(l>>24), byte(l>>16), byte(l>>8), byte(l), byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+        }
+    }
+
+    buf := append(tree, make([]byte, 16)...)
+    buf = append(buf, data...)
+    buf = append(buf, mmdbMetadataMarker...)
+    buf = append(buf, encodeMMDB(map[string]interface{}{
+        "node_count":                  uint32(len(nodes)),
+        "record_size":                 uint32(recordSize),
+        "ip_version":                  uint32(ipVersion),
+        "binary_format_major_version": uint32(2),
+        "database_type":               "Test-City",
+        "languages":                   []interface{}{"en"},
+    })...)
+    path := filepath.Join(t.TempDir(), "test.mmdb")
+    if err := os.WriteFile(path, buf, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// encodeMMDB encodes strings, uint32s, arrays and maps for the data section.
+func encodeMMDB(v interface{}) []byte {
+    header := func(kind, size int) []byte {
+        var b []byte
+        if kind > 7 {
+            b = []byte{0, byte(kind - 7)}
+        } else {
+            b = []byte{byte(kind << 5)}
+        }
+        if size >= 29 {
+            b[0] |= 29
+            return append(b, byte(size-29))
+        }
+        b[0] |= byte(size)
+        return b
+    }
+    switch v := v.(type) {
+    case string:
+        return append(header(mmdbString, len(v)), v...)
+    case uint32:
+        return append(header(mmdbUint32, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+    case []interface{}:
+        b := header(mmdbArray, len(v))
+        for _, item := range v {
+            b = append(b, encodeMMDB(item)...)
+        }
+        return b
+    case map[string]interface{}:
+        keys := make([]string, 0, len(v))
+        for key := range v {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        b := header(mmdbMap, len(v))
+        for _, key := range keys {
+            b = append(b, encodeMMDB(key)...)
+            b = append(b, encodeMMDB(v[key])...)
+        }
+        return b
+    default:
+        panic(fmt.Sprintf("cannot encode %T", v))
+    }
+}
+
+func cityRecord(country, region, city string) map[string]interface{} {
+    names := func(name string) map[string]interface{} {
+        return map[string]interface{}{"names": map[string]interface{}{"en": name}}
+    }
+    return map[string]interface{}{
+        "country":      map[string]interface{}{"iso_code": country},
+        "subdivisions": []interface{}{names(region)},
+        "city":         names(city),
+    }
+}
+
+func TestGeoIPLookup(t *testing.T) {
+    records := map[string]map[string]interface{}{
+        "198.51.100.0/24": cityRecord("DE", "Land Berlin", "Berlin"),
+        "203.0.113.128/25": cityRecord("US", "California", "Los Angeles"),
+        "2001:db8::/32":   {"country": map[string]interface{}{"iso_code": "JP"}},
+    }
+    tests := []struct {
+        ip   string
+        want Location
+        ok   bool
+    }{
+        {"198.51.100.7", Location{"DE", "Land Berlin", "Berlin"}, true},
+        {"203.0.113.200", Location{"US", "California", "Los Angeles"}, true},
+        {"203.0.113.7", Location{}, false},
+        {"2001:db8::1", Location{Country: "JP"}, true},
+        {"2001:db9::1", Location{}, false},
+    }
+    for _, size := range []int{24, 28, 32} {
+        for _, version := range []int{4, 6} {
+            db, err := OpenGeoIPDatabase(writeTestMMDB(t, version, size, records))
+            if err != nil {
+                t.Fatalf("IPv%d, %d bit records: %v", version, size, err)
+            }
+            for _, tt := range tests {
+                ip := net.ParseIP(tt.ip)
+                if version == 4 && ip.To4() == nil {
+                    continue
+                }
+                got, ok := db.Lookup(ip)
+                if got != tt.want || ok != tt.ok {
+                    t.Errorf("IPv%d, %d bit records: Lookup(%s) = %+v, %v, want %+v, %v", version, size, tt.ip, got, ok, tt.want, tt.ok)
+                }
+            }
+        }
+    }
+}
+
+func TestMMDBDecoderPointers(t *testing.T) {
+    // "en" at offset 0, then a map whose key points back at it.
+    data := append(encodeMMDB("en"), 0xe1, 0x20, 0x00, 0x43, 'a', 'b', 'c')
+    value, next, err := mmdbDecoder{data}.decode(3)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := map[string]interface{}{"en": "abc"}; !reflect.DeepEqual(value, want) {
+        t.Errorf("got %#v, want %#v", value, want)
+    }
+    if next != uint(len(data)) {
+        t.Errorf("next offset %d, want %d", next, len(data))
+    }
+}
+
+func TestOpenGeoIPDatabaseInvalid(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "bogus.mmdb")
+    os.WriteFile(path, []byte("not a database"), 0o644)
+    if _, err := OpenGeoIPDatabase(path); err == nil {
+        t.Error("expected an error for a file without metadata")
+    }
+}
+
+func TestGeoIPEnrichment(t *testing.T) {
+    db, err := OpenGeoIPDatabase(writeTestMMDB(t, 6, 24, map[string]map[string]interface{}{
+        "127.0.0.0/8":     cityRecord("US", "California", "Los Angeles"),
+        "198.51.100.0/24": cityRecord("DE", "Land Berlin", "Berlin"),
+    }))
+    if err != nil {
+        t.Fatal(err)
+    }
+    judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, "ip=198.51.100.7\n")
+    }))
+    defer judge.Close()
+
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{{URL: judge.URL, Contains: "ip="}}
+    pc.GeoIP = db
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    result := pc.CheckProxy(ctx, proxyFor(newForwardProxy(t, nil)))
+    if !result.Good {
+        t.Fatalf("expected proxy to pass: %v", result.Err)
+    }
+    if want := (Location{"US", "California", "Los Angeles"}); result.Proxy.Location != want {
+        t.Errorf("Location = %+v, want %+v", result.Proxy.Location, want)
+    }
+    if want := (Location{"DE", "Land Berlin", "Berlin"}); result.Proxy.ExitLocation != want {
+        t.Errorf("ExitLocation = %+v, want %+v", result.Proxy.ExitLocation, want)
+    }
+
+    // Filters go by where traffic leaves, not by the proxy address.
+    if got := pc.GetProxiesIn(Location{Country: "de", City: "berlin"}); len(got) != 1 {
+        t.Errorf("GetProxiesIn(DE, Berlin) returned %d proxies, want 1", len(got))
+    }
+    if got := pc.GetProxiesIn(Location{Country: "US"}); len(got) != 0 {
+        t.Errorf("GetProxiesIn(US) returned %d proxies, want 0", len(got))
+    }
+    if groups := pc.GroupByCountry(); len(groups) != 1 || len(groups["DE"]) != 1 {
+        t.Errorf("GroupByCountry() = %v", groups)
+    }
+
+    dir := t.TempDir()
+    for loc, want := range map[string]int{"DE": 1, "FR": 0} {
+        path := filepath.Join(dir, loc+".txt")
+        if err := pc.SaveProxiesToFileIn(path, Location{Country: loc}); err != nil {
+            t.Fatal(err)
+        }
+        data, _ := os.ReadFile(path)
+        if got := len(strings.Fields(string(data))); got != want {
+            t.Errorf("SaveProxiesToFileIn(%s) wrote %d proxies, want %d", loc, got, want)
+        }
+    }
+    report := filepath.Join(dir, "report.csv")
+    if err := pc.SaveProxyReportToFile(report); err != nil {
+        t.Fatal(err)
+    }
+    file, err := os.Open(report)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    rows, err := csv.NewReader(file).ReadAll()
+    if err != nil || len(rows) != 2 {
+        t.Fatalf("report has %d rows: %v", len(rows), err)
+    }
+    columns := map[string]string{}
+    for i, name := range rows[0] {
+        columns[name] = rows[1][i]
+    }
+    if columns["country"] != "US" || columns["exit_country"] != "DE" || columns["exit_city"] != "Berlin" {
+        t.Errorf("unexpected location columns: %v", columns)
+    }
+
+    proxy, err := pc.GetGoodProxyIn(ctx, Location{Country: "DE"})
+    if err != nil || proxy.ExitLocation.Country != "DE" {
+        t.Errorf("GetGoodProxyIn(DE) = %+v, %v", proxy, err)
+    }
+}
+
+func TestMMDBCorruptRecords(t *testing.T) {
+    // One node whose left record points into the separator and whose right
+    // record points far past the data section.
+    buf := []byte{0, 0, 0, 1 + mmdbDataSeparator - 1, 0xff, 0xff, 0xff, 0xff}
+    buf = append(buf, make([]byte, mmdbDataSeparator)...)
+    buf = append(buf, encodeMMDB("data")...)
+    buf = append(buf, mmdbMetadataMarker...)
+    buf = append(buf, encodeMMDB(map[string]interface{}{
+        "node_count":  uint32(1),
+        "record_size": uint32(32),
+        "ip_version":  uint32(4),
+    })...)
+    r, err := newMMDBReader(buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := r.lookup(net.ParseIP("10.0.0.1")); !errors.Is(err, errMMDBFormat) {
+        t.Errorf("record in the separator: got %v, want errMMDBFormat", err)
+    }
+    if _, err := r.lookup(net.ParseIP("200.0.0.1")); err == nil {
+        t.Error("record past the data section: expected an error")
+    }
+    if _, _, err := (mmdbDecoder{r.data}).decode(^uint(0)); err == nil {
+        t.Error("offset at the end of the address space: expected an error")
+    }
+}
@@ -0,0 +1,58 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// IntegrityCheck is a payload whose SHA-256 hash is known in advance. Plain
+// http:// URLs are the interesting ones, since that is where proxies can
+// inject ads or scripts.
+type IntegrityCheck struct {
+    URL string
+    // SHA256 is the hex encoded hash of the untouched body.
+    SHA256 string
+}
+
+// checkIntegrity fetches a random integrity payload through the proxy and
+// reports whether the body differs from the published hash.
+func (pc *ProxyChecker) checkIntegrity(ctx context.Context, p Proxy) (bool, error) {
+    check := pc.IntegrityChecks[rand.Intn(len(pc.IntegrityChecks))]
+    transport, release, err := pc.transport(ctx, p)
+    if err != nil {
+        return false, err
+    }
+    defer release()
+    client := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+    }
+    req, err := http.NewRequestWithContext(ctx, "GET", check.URL, nil)
+    if err != nil {
+        return false, err
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    // Ask for the body exactly as published, not re-encoded on the way.
+    req.Header.Set("Accept-Encoding", "identity")
+    resp, err := client.Do(req)
+    if err != nil {
+        return false, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return false, fmt.Errorf("integrity payload returned %s", resp.Status)
+    }
+    hash := sha256.New()
+    if _, err := io.Copy(hash, resp.Body); err != nil {
+        return false, err
+    }
+    return !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), check.SHA256), nil
+}
@@ -0,0 +1,65 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newInjectingProxy forwards plain http requests and appends a script to
+// every response body.
+func newInjectingProxy(t *testing.T) *httptest.Server {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        out := r.Clone(r.Context())
+        out.RequestURI = ""
+        resp, err := http.DefaultTransport.RoundTrip(out)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadGateway)
+            return
+        }
+        defer resp.Body.Close()
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+        w.Write([]byte("<script src=\"http://ads.example/x.js\"></script>"))
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestCheckIntegrity(t *testing.T) {
+    payload := []byte("<html><body>known payload</body></html>")
+    sum := sha256.Sum256(payload)
+    origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(payload)
+    }))
+    defer origin.Close()
+
+    honest := proxyFor(newForwardProxy(t, nil))
+    injecting := proxyFor(newInjectingProxy(t))
+
+    for _, allow := range []bool{false, true} {
+        pc := NewProxyChecker()
+        pc.Judges = []Judge{{URL: origin.URL, Contains: "known payload"}}
+        pc.IntegrityChecks = []IntegrityCheck{{URL: origin.URL, SHA256: hex.EncodeToString(sum[:])}}
+        pc.AllowInjecting = allow
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+        result, valid := pc.checkProxy(ctx, honest, []string{"http"})
+        if !valid || result.Injected {
+            t.Errorf("allow=%v: honest proxy: valid=%v injected=%v", allow, valid, result.Injected)
+        }
+        result, valid = pc.checkProxy(ctx, injecting, []string{"http"})
+        if !result.Injected {
+            t.Errorf("allow=%v: injecting proxy not flagged", allow)
+        }
+        if valid != allow {
+            t.Errorf("allow=%v: injecting proxy valid=%v", allow, valid)
+        }
+        cancel()
+    }
+}
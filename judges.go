@@ -0,0 +1,99 @@
+package proxychecker
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Judge is a URL a proxy has to fetch for a check to pass. Besides the
+// status code, the body must contain Contains and match Match when they are
+// set, so captive portals and injected error pages are not mistaken for the
+// genuine response.
+type Judge struct {
+    URL string
+    // ExpectedStatus defaults to 200 when zero.
+    ExpectedStatus int
+    Contains       string
+    Match          *regexp.Regexp
+    // MaxBodySize limits how many bytes are read; larger bodies fail the check.
+    MaxBodySize int64
+}
+
+// responseError is returned when a response arrived but failed the
+// expectations, either by its status or, with content set, by its body.
+type responseError struct {
+    status  int
+    content bool
+    msg     string
+}
+
+func (e *responseError) Error() string {
+    return e.msg
+}
+
+func (j Judge) scheme() string {
+    u, err := url.Parse(j.URL)
+    if err != nil {
+        return ""
+    }
+    return strings.ToLower(u.Scheme)
+}
+
+// validate reads the response body and checks it against the judge's
+// expectations. The body is returned so callers can inspect it further.
+func (j Judge) validate(resp *http.Response) ([]byte, error) {
+    expected := j.ExpectedStatus
+    if expected == 0 {
+        expected = http.StatusOK
+    }
+    var reader io.Reader = resp.Body
+    if j.MaxBodySize > 0 {
+        reader = io.LimitReader(resp.Body, j.MaxBodySize+1)
+    }
+    body, err := io.ReadAll(reader)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode != expected {
+        return body, &responseError{status: resp.StatusCode, msg: fmt.Sprintf("unexpected status %d", resp.StatusCode)}
+    }
+    if j.MaxBodySize > 0 && int64(len(body)) > j.MaxBodySize {
+        return body, &responseError{status: resp.StatusCode, content: true, msg: fmt.Sprintf("body exceeds %d bytes", j.MaxBodySize)}
+    }
+    if j.Contains != "" && !strings.Contains(string(body), j.Contains) {
+        return body, &responseError{status: resp.StatusCode, content: true, msg: fmt.Sprintf("body does not contain %q", j.Contains)}
+    }
+    if j.Match != nil && !j.Match.Match(body) {
+        return body, &responseError{status: resp.StatusCode, content: true, msg: fmt.Sprintf("body does not match %s", j.Match)}
+    }
+    return body, nil
+}
+
+// judgesFor returns the configured judges whose URL uses the given scheme.
+func (pc *ProxyChecker) judgesFor(scheme string) []Judge {
+    judges := pc.Judges
+    if len(judges) == 0 {
+        judges = defaultJudges
+    }
+    var candidates []Judge
+    for _, judge := range judges {
+        if judge.scheme() == scheme {
+            candidates = append(candidates, judge)
+        }
+    }
+    return candidates
+}
+
+// pickJudge returns a random judge whose URL uses the given scheme.
+func (pc *ProxyChecker) pickJudge(scheme string) (Judge, bool) {
+    candidates := pc.judgesFor(scheme)
+    if len(candidates) == 0 {
+        return Judge{}, false
+    }
+    return candidates[rand.Intn(len(candidates))], true
+}
@@ -0,0 +1,72 @@
+package proxychecker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJudgeValidate(t *testing.T) {
+    tests := []struct {
+        name   string
+        judge  Judge
+        status int
+        body   string
+        ok     bool
+    }{
+        {"default status", Judge{}, 200, "anything", true},
+        {"wrong status", Judge{}, 302, "", false},
+        {"expected status", Judge{ExpectedStatus: 204}, 204, "", true},
+        {"contains", Judge{Contains: "ip="}, 200, "fl=1\nip=1.2.3.4\n", true},
+        {"missing content", Judge{Contains: "ip="}, 200, "<h1>Login required</h1>", false},
+        {"match", Judge{Match: regexp.MustCompile(`^ok$`)}, 200, "ok", true},
+        {"no match", Judge{Match: regexp.MustCompile(`^ok$`)}, 200, "ok<script>", false},
+        {"within size", Judge{MaxBodySize: 4}, 200, "1234", true},
+        {"too large", Judge{MaxBodySize: 4}, 200, "12345", false},
+    }
+    for _, tt := range tests {
+        resp := &http.Response{
+            StatusCode: tt.status,
+            Body:       http.NoBody,
+        }
+        if tt.body != "" {
+            resp.Body = io.NopCloser(strings.NewReader(tt.body))
+        }
+        _, err := tt.judge.validate(resp)
+        if (err == nil) != tt.ok {
+            t.Errorf("%s: got err %v, want ok=%v", tt.name, err, tt.ok)
+        }
+    }
+}
+
+func TestCheckProxyJudgeContent(t *testing.T) {
+    judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("genuine judge content"))
+    }))
+    defer judge.Close()
+    portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("<h1>Please log in</h1>"))
+    }))
+    defer portal.Close()
+
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{{URL: judge.URL, Contains: "genuine judge content"}}
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    result, valid := pc.checkProxy(ctx, proxyFor(newForwardProxy(t, nil)), []string{"http"})
+    if !valid {
+        t.Fatal("expected honest proxy to pass")
+    }
+    if result.Type != "http" || !result.Capabilities.Has(CapHTTPForward) || result.Capabilities.Has(CapConnect443) {
+        t.Errorf("unexpected result %+v", result)
+    }
+    if _, valid := pc.checkProxy(ctx, proxyFor(portal), []string{"http"}); valid {
+        t.Error("expected captive portal to fail")
+    }
+}
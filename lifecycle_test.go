@@ -0,0 +1,67 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoGoroutineLeak(t *testing.T) {
+    judge := newJudge(t)
+    // An HTTP proxy never answers the SOCKS handshakes, so those probes
+    // hang until they are cancelled.
+    proxy := newForwardProxy(t, nil)
+    before := runtime.NumGoroutine()
+
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{judge}
+    pc.PrefilterTimeout = 0
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    start := time.Now()
+    pc.checkAll(ctx, []Proxy{{Address: strings.TrimPrefix(proxy.URL, "http://")}}, nil, nil, nil)
+    if elapsed := time.Since(start); elapsed > 5*time.Second {
+        t.Errorf("check waited %s for the losing protocols", elapsed)
+    }
+    if len(pc.GetAllProxies()) != 1 {
+        t.Fatal("proxy was not validated")
+    }
+    pc.Close()
+
+    deadline := time.Now().Add(5 * time.Second)
+    for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+        time.Sleep(20 * time.Millisecond)
+    }
+    if after := runtime.NumGoroutine(); after > before {
+        buf := make([]byte, 1<<16)
+        t.Errorf("%d goroutines before, %d after:\n%s", before, after, buf[:runtime.Stack(buf, true)])
+    }
+}
+
+func TestCloseCancelsChecks(t *testing.T) {
+    silent := listen(t, func(conn net.Conn) {
+        time.Sleep(10 * time.Second)
+        conn.Close()
+    })
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{{URL: "http://127.0.0.1:1/", Contains: "judge ok"}}
+    done := make(chan struct{})
+    go func() {
+        pc.checkAll(context.Background(), []Proxy{{Address: silent, Type: "http"}}, nil, nil, nil)
+        close(done)
+    }()
+    time.Sleep(100 * time.Millisecond)
+    pc.Close()
+    select {
+    case <-done:
+    case <-time.After(2 * time.Second):
+        t.Fatal("Close did not cancel the running check")
+    }
+    if err := pc.updateProxies(context.Background()); !errors.Is(err, ErrClosed) {
+        t.Errorf("got %v after Close, want ErrClosed", err)
+    }
+}
@@ -0,0 +1,307 @@
+package proxychecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+// mmdbMetadataMarker starts the metadata section at the end of a MaxMind DB.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbDataSeparator is the size of the zeroes between search tree and data.
+const mmdbDataSeparator = 16
+
+var errMMDBFormat = errors.New("invalid MaxMind DB")
+
+// mmdbReader looks up addresses in a MaxMind DB held in memory. See
+// https://maxmind.github.io/MaxMind-DB/ for the format.
+type mmdbReader struct {
+    buf        []byte
+    data       []byte
+    nodeCount  uint
+    recordSize uint
+    ipVersion  uint
+    ipv4Start  uint
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+    // The marker may appear in the data too, the last one is the real one.
+    start := bytes.LastIndex(buf, mmdbMetadataMarker)
+    if start < 0 {
+        return nil, fmt.Errorf("%w: metadata not found", errMMDBFormat)
+    }
+    metaStart := start + len(mmdbMetadataMarker)
+    meta, _, err := mmdbDecoder{buf[metaStart:]}.decode(0)
+    if err != nil {
+        return nil, fmt.Errorf("%w: metadata: %v", errMMDBFormat, err)
+    }
+    fields, ok := meta.(map[string]interface{})
+    if !ok {
+        return nil, fmt.Errorf("%w: metadata is not a map", errMMDBFormat)
+    }
+    r := &mmdbReader{
+        buf:        buf,
+        nodeCount:  mmdbUint(fields["node_count"]),
+        recordSize: mmdbUint(fields["record_size"]),
+        ipVersion:  mmdbUint(fields["ip_version"]),
+    }
+    switch r.recordSize {
+    case 24, 28, 32:
+    default:
+        return nil, fmt.Errorf("%w: unsupported record size %d", errMMDBFormat, r.recordSize)
+    }
+    if r.ipVersion != 4 && r.ipVersion != 6 {
+        return nil, fmt.Errorf("%w: unsupported IP version %d", errMMDBFormat, r.ipVersion)
+    }
+    treeSize := r.nodeCount * r.recordSize / 4
+    if treeSize+mmdbDataSeparator > uint(start) {
+        return nil, fmt.Errorf("%w: search tree exceeds file", errMMDBFormat)
+    }
+    r.data = buf[treeSize+mmdbDataSeparator : start]
+    // IPv4 addresses live under ::/96 of an IPv6 tree.
+    if r.ipVersion == 6 {
+        for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+            r.ipv4Start = r.record(r.ipv4Start, 0)
+        }
+    }
+    return r, nil
+}
+
+// lookup returns the record stored for ip, or nil when there is none.
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+    node := uint(0)
+    bits := ip.To4()
+    if bits != nil {
+        if r.ipVersion == 6 {
+            node = r.ipv4Start
+        }
+    } else if r.ipVersion == 4 {
+        return nil, nil
+    } else if bits = ip.To16(); bits == nil {
+        return nil, fmt.Errorf("invalid IP address %v", ip)
+    }
+    for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+        node = r.record(node, uint(bits[i/8]>>(7-i%8))&1)
+    }
+    if node <= r.nodeCount {
+        return nil, nil
+    }
+    // Values between the node count and the data section point nowhere.
+    if node < r.nodeCount+mmdbDataSeparator {
+        return nil, fmt.Errorf("%w: record %d points into the separator", errMMDBFormat, node)
+    }
+    offset := node - r.nodeCount - mmdbDataSeparator
+    value, _, err := mmdbDecoder{r.data}.decode(offset)
+    return value, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a tree node.
+func (r *mmdbReader) record(node, bit uint) uint {
+    b := r.buf[node*r.recordSize/4:]
+    switch r.recordSize {
+    case 24:
+        b = b[bit*3:]
+        return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+    case 28:
+        // The middle byte holds the high nibbles of both records.
+        if bit == 0 {
+            return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+        }
+        return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+    default:
+        return uint(binary.BigEndian.Uint32(b[bit*4:]))
+    }
+}
+
+// mmdbDecoder decodes values of the MaxMind DB data section into strings,
+// numbers, booleans, []byte, []interface{} and map[string]interface{}.
+type mmdbDecoder struct {
+    data []byte
+}
+
+const (
+    mmdbExtended = iota
+    mmdbPointer
+    mmdbString
+    mmdbDouble
+    mmdbBytes
+    mmdbUint16
+    mmdbUint32
+    mmdbMap
+    mmdbInt32
+    mmdbUint64
+    mmdbUint128
+    mmdbArray
+    mmdbContainer
+    mmdbEndMarker
+    mmdbBool
+    mmdbFloat
+)
+
+// decode returns the value at offset and the offset following it.
+func (d mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+    return d.decodeDepth(offset, 0)
+}
+
+func (d mmdbDecoder) decodeDepth(offset uint, depth int) (interface{}, uint, error) {
+    if depth > 32 {
+        return nil, 0, errors.New("data nested too deeply")
+    }
+    kind, size, offset, err := d.header(offset)
+    if err != nil {
+        return nil, 0, err
+    }
+    if kind == mmdbPointer {
+        // A pointer is followed by the next value, not the one it points at.
+        value, _, err := d.decodeDepth(size, depth+1)
+        return value, offset, err
+    }
+    if kind == mmdbMap || kind == mmdbArray {
+        var entries []interface{}
+        items := size
+        if kind == mmdbMap {
+            items *= 2
+        }
+        for i := uint(0); i < items; i++ {
+            var value interface{}
+            if value, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+                return nil, 0, err
+            }
+            entries = append(entries, value)
+        }
+        if kind == mmdbArray {
+            return entries, offset, nil
+        }
+        m := make(map[string]interface{}, size)
+        for i := 0; i < len(entries); i += 2 {
+            key, ok := entries[i].(string)
+            if !ok {
+                return nil, 0, errors.New("map key is not a string")
+            }
+            m[key] = entries[i+1]
+        }
+        return m, offset, nil
+    }
+    if kind == mmdbBool {
+        return size != 0, offset, nil
+    }
+    if !d.fits(offset, size) {
+        return nil, 0, errors.New("value exceeds data section")
+    }
+    b := d.data[offset : offset+size]
+    offset += size
+    switch kind {
+    case mmdbString:
+        return string(b), offset, nil
+    case mmdbBytes, mmdbUint128:
+        return append([]byte(nil), b...), offset, nil
+    case mmdbDouble:
+        if size != 8 {
+            return nil, 0, errors.New("invalid double size")
+        }
+        return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+    case mmdbFloat:
+        if size != 4 {
+            return nil, 0, errors.New("invalid float size")
+        }
+        return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+    case mmdbUint16, mmdbUint32, mmdbUint64:
+        var n uint64
+        for _, c := range b {
+            n = n<<8 | uint64(c)
+        }
+        return n, offset, nil
+    case mmdbInt32:
+        var n uint32
+        for _, c := range b {
+            n = n<<8 | uint32(c)
+        }
+        return int64(int32(n)), offset, nil
+    default:
+        return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+    }
+}
+
+// header reads the control byte at offset. For pointers size is the offset
+// pointed at, for everything else the size of the payload that follows.
+func (d mmdbDecoder) header(offset uint) (kind, size, next uint, err error) {
+    read := func(n uint) (uint, error) {
+        if !d.fits(offset, n) {
+            return 0, errors.New("value exceeds data section")
+        }
+        var v uint
+        for _, c := range d.data[offset : offset+n] {
+            v = v<<8 | uint(c)
+        }
+        offset += n
+        return v, nil
+    }
+    control, err := read(1)
+    if err != nil {
+        return 0, 0, 0, err
+    }
+    kind = control >> 5
+    if kind == mmdbPointer {
+        n := control >> 3 & 0x3
+        v, err := read(n + 1)
+        if err != nil {
+            return 0, 0, 0, err
+        }
+        switch n {
+        case 0:
+            size = (control&0x7)<<8 | v
+        case 1:
+            size = (control&0x7)<<16 | v + 2048
+        case 2:
+            size = (control&0x7)<<24 | v + 526336
+        default:
+            size = v
+        }
+        return kind, size, offset, nil
+    }
+    if kind == mmdbExtended {
+        extended, err := read(1)
+        if err != nil {
+            return 0, 0, 0, err
+        }
+        kind = 7 + extended
+    }
+    size = control & 0x1f
+    switch size {
+    case 29:
+        v, err := read(1)
+        size = 29 + v
+        if err != nil {
+            return 0, 0, 0, err
+        }
+    case 30:
+        v, err := read(2)
+        size = 285 + v
+        if err != nil {
+            return 0, 0, 0, err
+        }
+    case 31:
+        v, err := read(3)
+        size = 65821 + v
+        if err != nil {
+            return 0, 0, 0, err
+        }
+    }
+    return kind, size, offset, nil
+}
+
+// fits reports whether n bytes at offset are within the data section,
+// without offset+n overflowing for offsets read from a corrupt file.
+func (d mmdbDecoder) fits(offset, n uint) bool {
+    return offset <= uint(len(d.data)) && n <= uint(len(d.data))-offset
+}
+
+// mmdbUint returns an unsigned metadata value, or zero.
+func mmdbUint(v interface{}) uint {
+    n, _ := v.(uint64)
+    return uint(n)
+}
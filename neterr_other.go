@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package proxychecker
+
+// isRefusedError and isResetError report false where connection errors
+// don't carry errno values; such failures are classified by what else is
+// known about them.
+func isRefusedError(err error) bool {
+    return false
+}
+
+func isResetError(err error) bool {
+    return false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package proxychecker
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isRefusedError reports whether the connection was refused.
+func isRefusedError(err error) bool {
+    return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// isResetError reports whether the connection was reset by the peer.
+func isResetError(err error) bool {
+    return errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,19 @@
+package proxychecker
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeconnrefused is WSAECONNREFUSED, which package syscall does not define.
+const wsaeconnrefused = syscall.Errno(10061)
+
+// isRefusedError reports whether the connection was refused.
+func isRefusedError(err error) bool {
+    return errors.Is(err, wsaeconnrefused)
+}
+
+// isResetError reports whether the connection was reset by the peer.
+func isResetError(err error) bool {
+    return errors.Is(err, syscall.WSAECONNRESET)
+}
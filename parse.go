@@ -0,0 +1,110 @@
+package proxychecker
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ParseProxy parses a proxy in one of the forms
+//
+//	host:port
+//	user:pass@host:port
+//	host:port:user:pass
+//	scheme://[user:pass@]host:port
+//
+// The scheme, when present, becomes the proxy Type.
+func ParseProxy(s string) (Proxy, error) {
+    s = strings.TrimSpace(s)
+    var p Proxy
+    if scheme, rest, found := strings.Cut(s, "://"); found {
+        u, err := url.Parse(s)
+        if err != nil {
+            return Proxy{}, err
+        }
+        p.Type = strings.ToLower(scheme)
+        p.Address = u.Host
+        if u.User != nil {
+            p.Username = u.User.Username()
+            p.Password, _ = u.User.Password()
+        }
+        if u.Path != "" || rest == "" {
+            return Proxy{}, fmt.Errorf("invalid proxy %q", s)
+        }
+    } else if at := strings.LastIndex(s, "@"); at >= 0 {
+        user, pass, _ := strings.Cut(s[:at], ":")
+        p.Address, p.Username, p.Password = s[at+1:], user, pass
+    } else if hostPort, user, pass, ok := splitTrailingCredentials(s); ok {
+        p.Address, p.Username, p.Password = hostPort, user, pass
+    } else {
+        p.Address = s
+    }
+    if !isValidProxyFormat(p.Address) {
+        return Proxy{}, fmt.Errorf("invalid proxy address %q", p.Address)
+    }
+    return p, nil
+}
+
+// AddProxies parses the given entries with ParseProxy and checks them on
+// every refresh alongside the scraped proxies.
+func (pc *ProxyChecker) AddProxies(entries ...string) error {
+    proxies := make([]Proxy, 0, len(entries))
+    for _, entry := range entries {
+        p, err := ParseProxy(entry)
+        if err != nil {
+            return err
+        }
+        proxies = append(proxies, p)
+    }
+    pc.CacheLock.Lock()
+    pc.seeds = append(pc.seeds, proxies...)
+    pc.CacheLock.Unlock()
+    return nil
+}
+
+// LoadProxiesFromFile adds one proxy per non-empty line of filename, see AddProxies.
+// Lines starting with # are ignored.
+func (pc *ProxyChecker) LoadProxiesFromFile(filename string) error {
+    file, err := os.Open(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    var entries []string
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        entries = append(entries, line)
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    return pc.AddProxies(entries...)
+}
+
+// splitTrailingCredentials splits host:port:user:pass, where host may be a
+// bracketed IPv6 literal.
+func splitTrailingCredentials(s string) (hostPort, user, pass string, ok bool) {
+    if strings.HasPrefix(s, "[") {
+        end := strings.Index(s, "]")
+        if end < 0 {
+            return "", "", "", false
+        }
+        parts := strings.SplitN(strings.TrimPrefix(s[end+1:], ":"), ":", 3)
+        if len(parts) != 3 {
+            return "", "", "", false
+        }
+        return s[:end+1] + ":" + parts[0], parts[1], parts[2], true
+    }
+    parts := strings.SplitN(s, ":", 4)
+    if len(parts) != 4 {
+        return "", "", "", false
+    }
+    return parts[0] + ":" + parts[1], parts[2], parts[3], true
+}
@@ -0,0 +1,87 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// socks5Greeting offers SOCKS5 with no authentication. SOCKS proxies answer
+// it straight away, HTTP proxies keep waiting for the rest of a request line.
+var socks5Greeting = []byte{0x05, 0x01, 0x00}
+
+var errNotListening = errors.New("proxy is not accepting connections")
+
+// prefilter returns a check that reports whether a proxy is even accepting
+// TCP connections, so only the survivors go through the expensive protocol
+// checks. At most PrefilterConcurrency run at once. It returns nil when
+// PrefilterTimeout is zero.
+func (pc *ProxyChecker) prefilter() func(context.Context, Proxy) bool {
+    if pc.PrefilterTimeout <= 0 {
+        return nil
+    }
+    concurrency := pc.PrefilterConcurrency
+    if concurrency <= 0 {
+        concurrency = 1
+    }
+    semaphore := make(chan struct{}, concurrency)
+    return func(ctx context.Context, p Proxy) bool {
+        select {
+        case semaphore <- struct{}{}:
+        case <-ctx.Done():
+            return false
+        }
+        defer func() { <-semaphore }()
+        return pc.isListening(ctx, p)
+    }
+}
+
+// isListening connects to the proxy with PrefilterTimeout. With
+// PrefilterGreeting set it also sends a SOCKS5 greeting and rejects ports
+// that close the connection on it instead of answering or waiting for more.
+// SOCKS4 servers hang up on a SOCKS5 greeting, so a port that does gets a
+// second chance with a SOCKS4 request before it is rejected.
+func (pc *ProxyChecker) isListening(ctx context.Context, p Proxy) bool {
+    if !pc.PrefilterGreeting {
+        conn, err := (&net.Dialer{Timeout: pc.PrefilterTimeout}).DialContext(ctx, "tcp", p.hostPort())
+        if err != nil {
+            return false
+        }
+        conn.Close()
+        return true
+    }
+    alive, hungUp := pc.greet(ctx, p, socks5Greeting)
+    if hungUp {
+        alive, _ = pc.greet(ctx, p, sniffSocks4Request)
+    }
+    return alive
+}
+
+// greet sends greeting on a new connection. The proxy is alive when it
+// answers or keeps waiting for more; hungUp tells whether it accepted the
+// connection but closed it instead. A server closing with part of the
+// greeting unread sends a reset, so that counts as hanging up too.
+func (pc *ProxyChecker) greet(ctx context.Context, p Proxy, greeting []byte) (alive, hungUp bool) {
+    dialer := &net.Dialer{Timeout: pc.PrefilterTimeout}
+    conn, err := dialer.DialContext(ctx, "tcp", p.hostPort())
+    if err != nil {
+        return false, false
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(pc.PrefilterTimeout))
+    defer interruptOnDone(ctx, conn)()
+    if _, err := conn.Write(greeting); err != nil {
+        return false, false
+    }
+    var reply [1]byte
+    _, err = conn.Read(reply[:])
+    if err == nil {
+        return true, false
+    }
+    var netErr net.Error
+    if errors.As(err, &netErr) && netErr.Timeout() {
+        return true, false
+    }
+    return false, true
+}
@@ -0,0 +1,131 @@
+package proxychecker
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T, handle func(net.Conn)) string {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { ln.Close() })
+    go func() {
+        for {
+            conn, err := ln.Accept()
+            if err != nil {
+                return
+            }
+            go handle(conn)
+        }
+    }()
+    return ln.Addr().String()
+}
+
+func TestPrefilter(t *testing.T) {
+    // Waits for more input, like an HTTP proxy given a SOCKS greeting.
+    waiting := listen(t, func(conn net.Conn) {
+        time.Sleep(time.Second)
+        conn.Close()
+    })
+    // Answers the greeting, like a SOCKS5 proxy.
+    answering := listen(t, func(conn net.Conn) {
+        conn.Write([]byte{0x05, 0x00})
+        time.Sleep(time.Second)
+        conn.Close()
+    })
+    // Hangs up on anything it does not understand.
+    hangingUp := listen(t, func(conn net.Conn) {
+        conn.Close()
+    })
+    // Hangs up on a SOCKS5 greeting but answers SOCKS4, like a SOCKS4-only
+    // proxy.
+    socks4Only := listen(t, func(conn net.Conn) {
+        defer conn.Close()
+        var version [1]byte
+        if _, err := conn.Read(version[:]); err != nil || version[0] != 0x04 {
+            return
+        }
+        conn.Write([]byte{0x00, 0x5a, 0, 0, 0, 0, 0, 0})
+    })
+    closedLn, _ := net.Listen("tcp", "127.0.0.1:0")
+    closed := closedLn.Addr().String()
+    closedLn.Close()
+
+    proxies := []Proxy{{Address: waiting}, {Address: answering}, {Address: hangingUp}, {Address: socks4Only}, {Address: closed}}
+    tests := []struct {
+        greeting bool
+        want     []string
+    }{
+        {false, []string{waiting, answering, hangingUp, socks4Only}},
+        {true, []string{waiting, answering, socks4Only}},
+    }
+    for _, tt := range tests {
+        pc := NewProxyChecker()
+        pc.PrefilterTimeout = 200 * time.Millisecond
+        pc.PrefilterGreeting = tt.greeting
+        listening := pc.prefilter()
+        var got []string
+        for _, p := range proxies {
+            if listening(context.Background(), p) {
+                got = append(got, p.Address)
+            }
+        }
+        sort.Strings(got)
+        sort.Strings(tt.want)
+        if len(got) != len(tt.want) {
+            t.Errorf("greeting=%v: got %v, want %v", tt.greeting, got, tt.want)
+            continue
+        }
+        for i := range got {
+            if got[i] != tt.want[i] {
+                t.Errorf("greeting=%v: got %v, want %v", tt.greeting, got, tt.want)
+                break
+            }
+        }
+    }
+}
+
+func TestPrefilterStreamsSurvivors(t *testing.T) {
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{newJudge(t)}
+    pc.PrefilterTimeout = 5 * time.Second
+    pc.PrefilterGreeting = true
+    pc.CheckLimit = 1
+    defer pc.Close()
+    // Waiting ports only pass the prefilter when its timeout runs out.
+    var proxies []Proxy
+    for i := 0; i < 5; i++ {
+        proxies = append(proxies, Proxy{Address: listen(t, func(conn net.Conn) {
+            time.Sleep(10 * time.Second)
+            conn.Close()
+        }), Type: "http"})
+    }
+    socks := newSocks5Server(t, "", "")
+    proxies = append(proxies, Proxy{Address: socks.Addr(), Type: "socks5"})
+
+    start := time.Now()
+    var mu sync.Mutex
+    var results []CheckResult
+    emit := func(result CheckResult) {
+        mu.Lock()
+        results = append(results, result)
+        mu.Unlock()
+    }
+    if err := pc.checkAll(context.Background(), proxies, pc.prefilter(), nil, emit); err != nil {
+        t.Fatal(err)
+    }
+    // The SOCKS5 proxy answers the greeting at once, is checked while the
+    // others are still being prefiltered and its result stops the run.
+    if elapsed := time.Since(start); elapsed > 3*time.Second {
+        t.Errorf("run took %s, the prefilter was not cut short", elapsed)
+    }
+    if len(results) != 1 || !results[0].Good {
+        t.Errorf("got results %+v, want only the good SOCKS5 proxy", results)
+    }
+}
@@ -2,60 +2,139 @@ package proxychecker
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
-	"math/rand"
-	"net"
 	"net/http"
-	"net/url"
-	"strings"
+	"net/http/httptrace"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func (pc *ProxyChecker) checkProxy(ctx context.Context, p Proxy, proxyTypes []string) (string, bool) {
+var (
+    errNoJudge       = errors.New("no judge configured")
+    errInvalidFormat = errors.New("invalid proxy address")
+    errNoProtocol    = errors.New("proxy failed the check with every protocol")
+    errTLSTampered   = errors.New("proxy intercepts TLS")
+    errInjected      = errors.New("proxy injects content into responses")
+    errUnreliable    = errors.New("proxy success ratio below threshold")
+)
+
+// protocolError is returned when a proxy failed with every protocol. It
+// wraps the error of the attempt that got furthest, along with the protocol
+// and timings of that attempt.
+type protocolError struct {
+    protocol string
+    timings  Timings
+    cause    error
+}
+
+func (e *protocolError) Error() string {
+    if e.cause == nil {
+        return errNoProtocol.Error()
+    }
+    return errNoProtocol.Error() + ": " + e.cause.Error()
+}
+
+func (e *protocolError) Unwrap() error {
+    return e.cause
+}
+
+func (e *protocolError) Is(target error) bool {
+    return target == errNoProtocol
+}
+
+// checkProxy runs the built-in checks and records the outcome.
+func (pc *ProxyChecker) checkProxy(ctx context.Context, p Proxy, proxyTypes []string) (Proxy, bool) {
+    result, err := pc.runChecks(ctx, p, proxyTypes)
+    return pc.record(p, result, err)
+}
+
+// record adds a proxy that passed its checks to the pool. Proxies that were
+// reached but rejected are remembered as bad.
+func (pc *ProxyChecker) record(p Proxy, result Proxy, err error) (Proxy, bool) {
+    if err != nil {
+        if result.Type != "" {
+            pc.Proxies.Store(Proxy{Address: result.Address, Type: result.Type}, false)
+        }
+        return result, false
+    }
+    if result.Type == "" {
+        result.Type = p.scheme()
+    }
+    checked := result
+    checked.Address = fmt.Sprintf("%s://%s", result.Type, p.hostPort())
+    pc.CacheLock.Lock()
+    pc.Cache = append(pc.Cache, checked)
+    close(pc.cacheAddedLocked())
+    pc.cacheAdded = nil
+    pc.CacheLock.Unlock()
+    pc.Proxies.Store(Proxy{Address: result.Address, Type: result.Type}, true)
+    return result, true
+}
+
+// runChecks tries p with every protocol in proxyTypes and runs the enabled
+// checks on the first one that works. A protocol works when the proxy passes
+// a judge or, when Targets are configured, at least one of the targets. A
+// rejected proxy is returned together with the reason so it can be
+// remembered as bad.
+func (pc *ProxyChecker) runChecks(ctx context.Context, p Proxy, proxyTypes []string) (Proxy, error) {
     if !isValidProxyFormat(p.Address) {
-        return "", false
+        return Proxy{}, errInvalidFormat
     }
-    randomServer := httpServers[rand.Intn(len(httpServers))]
-    results := make(chan string, len(proxyTypes))
+    secureJudge, hasSecure := pc.pickJudge("https")
+    plainJudge, hasPlain := pc.pickJudge("http")
+    useTargets := len(pc.Targets) > 0
+    if !hasSecure && !hasPlain && !useTargets {
+        return Proxy{}, errNoJudge
+    }
+    ctx, closeTransports := withTransports(ctx)
+    defer closeTransports()
+    // The protocols race each other; once one wins the others are pointless.
+    probeCtx, cancelProbes := context.WithCancel(ctx)
+    defer cancelProbes()
+    results := make(chan Proxy, len(proxyTypes))
+    var failure *protocolError
+    var failureLock sync.Mutex
     var wg sync.WaitGroup
+    // Losing probes must be gone before their transports are closed.
+    defer func() {
+        cancelProbes()
+        wg.Wait()
+    }()
     for _, proxyType := range proxyTypes {
         wg.Add(1)
         go func(pt string) {
             defer wg.Done()
-            proxyURL, err := url.Parse(fmt.Sprintf("%s://%s", strings.ToLower(pt), p.Address))
-            if err != nil {
-                return
+            var caps Capability
+            var timings Timings
+            var body []byte
+            var report *TargetReport
+            err := errNoJudge
+            if useTargets {
+                report, err = pc.checkTargets(probeCtx, Proxy{Address: p.Address, Type: pt, Username: p.Username, Password: p.Password})
+                caps, timings.Total = report.capabilities(pc.Targets), report.fastest()
+            } else {
+                if hasSecure {
+                    caps = CapConnect443
+                    timings, body, err = pc.probe(probeCtx, p, pt, secureJudge)
+                }
+                if err != nil && hasPlain {
+                    caps = CapHTTPForward
+                    timings, body, err = pc.probe(probeCtx, p, pt, plainJudge)
+                }
             }
-            transport := &http.Transport{
-                Proxy: http.ProxyURL(proxyURL),
-                DialContext: (&net.Dialer{
-                    Timeout: 20 * time.Second,
-                }).DialContext,
-            }
-            localClient := &http.Client{
-                Transport: transport,
-                Timeout:   pc.Client.Timeout,
-            }
-            req, err := http.NewRequestWithContext(ctx, "GET", randomServer, nil)
             if err != nil {
-                return
-            }
-			for key, value := range pc.Headers {
-				req.Header.Set(key, value)
-			}
-            resp, err := localClient.Do(req)
-            if err != nil {
-                return
-            }
-            defer resp.Body.Close()
-            _, err = io.ReadAll(resp.Body)
-            if err != nil || resp.StatusCode != http.StatusOK {
+                failureLock.Lock()
+                if failure == nil || progress(err) > progress(failure.cause) {
+                    failure = &protocolError{protocol: pt, timings: timings, cause: err}
+                }
+                failureLock.Unlock()
                 return
             }
             select {
-            case results <- pt:
+            case results <- Proxy{Address: p.Address, Type: pt, Username: p.Username, Password: p.Password, Timings: timings, Capabilities: caps, ExitIP: extractIP(body), Targets: report}:
             default:
             }
         }(proxyType)
@@ -64,45 +143,229 @@ func (pc *ProxyChecker) checkProxy(ctx context.Context, p Proxy, proxyTypes []st
         wg.Wait()
         close(results)
     }()
+    var result Proxy
     select {
-    case result := <-results:
-        if result != "" {
-            fullAddress := fmt.Sprintf("%s://%s", result, p.Address)
-            pc.CacheLock.Lock()
-            pc.Cache = append(pc.Cache, Proxy{Address: fullAddress, Type: result})
-            pc.CacheLock.Unlock()
-            pc.Proxies.Store(Proxy{Address: p.Address, Type: result}, true)
-            return result, true
+    case r, ok := <-results:
+        if !ok {
+            failureLock.Lock()
+            defer failureLock.Unlock()
+            if failure == nil {
+                return Proxy{}, &protocolError{}
+            }
+            return Proxy{}, failure
         }
+        result = r
     case <-ctx.Done():
-        return "", false
+        return Proxy{}, ctx.Err()
     }
-    return "", false
+    cancelProbes()
+
+    if pc.Samples > 1 {
+        scheme, judge := "https", secureJudge
+        if !result.Capabilities.Has(CapConnect443) {
+            scheme, judge = "http", plainJudge
+        }
+        result.SuccessRatio, result.LatencySpread = pc.sampleReliability(ctx, result, scheme, judge, result.Timings.Total)
+        if result.SuccessRatio < pc.MinSuccessRatio {
+            return result, errUnreliable
+        }
+    }
+    if pc.DetectTLSTampering && hasSecure {
+        tampered, err := pc.checkTLSTampering(ctx, result, secureJudge.URL)
+        if err == nil && tampered {
+            result.TLSTampered = true
+            return result, errTLSTampered
+        }
+    }
+    if len(pc.IntegrityChecks) > 0 {
+        injected, err := pc.checkIntegrity(ctx, result)
+        if err == nil && injected {
+            result.Injected = true
+            if !pc.AllowInjecting {
+                return result, errInjected
+            }
+        }
+    }
+    if hasPlain && !result.Capabilities.Has(CapHTTPForward) {
+        if _, _, err := pc.probe(ctx, p, result.Type, plainJudge); err == nil {
+            result.Capabilities |= CapHTTPForward
+        }
+    }
+    result.Capabilities |= pc.probeCapabilities(ctx, result)
+    if pc.RotationSamples > 1 {
+        if ips, err := pc.sampleExitIPs(ctx, result, pc.RotationSamples); err == nil {
+            if result.ExitIP == "" {
+                result.ExitIP = ips[0]
+            }
+            result.Rotating = len(distinct(ips)) > 1
+        }
+    }
+    if pc.CheckAnonymity {
+        if level, err := pc.checkAnonymity(ctx, result); err == nil {
+            result.Anonymity = level
+        }
+    }
+    if pc.ThroughputURL != "" {
+        if throughput, err := pc.measureThroughput(ctx, result); err == nil {
+            result.Throughput = throughput
+        }
+    }
+    if pc.AnalyzeTampering {
+        if report, err := pc.analyzeTampering(ctx, result); err == nil {
+            result.Tampering = &report
+        }
+    }
+    return result, nil
+}
+
+// probe sends a single request to the judge through the proxy p using the
+// given protocol and reports how long each phase of the request took along
+// with the body the judge returned.
+func (pc *ProxyChecker) probe(ctx context.Context, p Proxy, proxyType string, judge Judge) (Timings, []byte, error) {
+    var timings Timings
+    transport, release, err := pc.transport(ctx, Proxy{Address: p.Address, Type: proxyType, Username: p.Username, Password: p.Password})
+    if err != nil {
+        return timings, nil, err
+    }
+    defer release()
+    localClient := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+        // A redirect from http:// to https:// would turn a plain forwarding
+        // probe into a CONNECT probe, so stay on the scheme we started with.
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            if req.URL.Scheme != via[0].URL.Scheme {
+                return http.ErrUseLastResponse
+            }
+            return nil
+        },
+    }
+
+    var connectStart, tlsStart time.Time
+    start := time.Now()
+    trace := &httptrace.ClientTrace{
+        ConnectStart: func(_, _ string) {
+            connectStart = time.Now()
+        },
+        ConnectDone: func(_, _ string, err error) {
+            if err == nil && !connectStart.IsZero() {
+                timings.Connect = time.Since(connectStart)
+            }
+        },
+        TLSHandshakeStart: func() {
+            tlsStart = time.Now()
+        },
+        TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+            if err == nil && !tlsStart.IsZero() {
+                timings.TLSHandshake = time.Since(tlsStart)
+            }
+        },
+        GotFirstResponseByte: func() {
+            timings.FirstByte = time.Since(start)
+        },
+    }
+    req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), "GET", judge.URL, nil)
+    if err != nil {
+        return timings, nil, err
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    resp, err := localClient.Do(req)
+    if err != nil {
+        return timings, nil, err
+    }
+    defer resp.Body.Close()
+    body, err := judge.validate(resp)
+    if err != nil {
+        return timings, nil, err
+    }
+    timings.Total = time.Since(start)
+    return timings, body, nil
 }
 
 func (pc *ProxyChecker) updateProxies(ctx context.Context) error {
+    return pc.refresh(ctx, nil)
+}
+
+// refresh scrapes the sources, adds the seeds and checks them all. emit, when
+// not nil, is called with the outcome for every proxy.
+func (pc *ProxyChecker) refresh(ctx context.Context, emit func(CheckResult)) error {
+    ctx, cancel, ok := pc.begin(ctx)
+    if !ok {
+        return ErrClosed
+    }
+    defer cancel()
     scrapedProxies, err := pc.scrapeProxies(ctx)
     if err != nil {
         return err
     }
+    pc.CacheLock.Lock()
+    scrapedProxies = append(append([]Proxy(nil), pc.seeds...), scrapedProxies...)
+    pc.CacheLock.Unlock()
     fmt.Println("Number of proxies scraped:", len(scrapedProxies))
-    semaphore := make(chan struct{}, pc.ConcurrencyLimit)
+    return pc.checkAll(ctx, scrapedProxies, pc.prefilter(), pc.startRunStats(), emit)
+}
+
+// checkAll checks proxies concurrently and adds the good ones to the pool.
+// When listening is not nil, proxies it rejects are dropped before their
+// protocol check and each survivor is checked as soon as it passes. Outcomes
+// are added to stats, or to new run statistics when it is nil, and passed to
+// emit when it is not nil. It returns ErrClosed when pc is closed.
+func (pc *ProxyChecker) checkAll(ctx context.Context, proxies []Proxy, listening func(context.Context, Proxy) bool, stats *runStats, emit func(CheckResult)) error {
+    ctx, cancel, ok := pc.begin(ctx)
+    if !ok {
+        return ErrClosed
+    }
+    defer cancel()
+    ctx, stop := context.WithCancel(ctx)
+    defer stop()
+    var good int64
+    if stats == nil {
+        stats = pc.startRunStats()
+    }
+    defer stats.finish()
+    controller := pc.newConcurrencyController()
+    pc.controllerLock.Lock()
+    pc.controller = controller
+    pc.controllerLock.Unlock()
     var wg sync.WaitGroup
 
-    for _, proxy := range scrapedProxies {
+    for _, proxy := range proxies {
         wg.Add(1)
         go func(p Proxy) {
             defer wg.Done()
-            semaphore <- struct{}{}
-            result, valid := pc.checkProxy(ctx, p, proxyTypes)
-            <-semaphore
-            if valid {
-                fullAddress := fmt.Sprintf("%s://%s", result, p.Address)
-                pc.Proxies.Store(fullAddress, Proxy{Address: fullAddress, Type: result})
+            if listening != nil && !listening(ctx, p) {
+                if ctx.Err() != nil {
+                    return
+                }
+                result := newCheckResult(p, Proxy{}, false, errNotListening)
+                stats.add(result)
+                if emit != nil {
+                    emit(result)
+                }
+                return
+            }
+            if controller.acquire(ctx) != nil {
+                return
+            }
+            result := pc.checkOne(ctx, p)
+            controller.release(result.Err)
+            if result.Good {
+                if pc.CheckLimit > 0 && atomic.AddInt64(&good, 1) >= int64(pc.CheckLimit) {
+                    stop()
+                }
+            } else if ctx.Err() != nil {
+                // Cut short by the caller or by reaching CheckLimit; the
+                // proxy was never really judged.
+                return
+            }
+            stats.add(result)
+            if emit != nil {
+                emit(result)
             }
         }(proxy)
     }
     wg.Wait()
     return nil
 }
-
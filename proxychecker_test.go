@@ -45,8 +45,8 @@ func TestCheckProxy(t *testing.T) {
     proxyTypes := []string{"http", "socks4", "socks5"}
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
-    proxyType, valid := pc.checkProxy(ctx, proxy, proxyTypes)
-    println(proxyType, valid)
+    result, valid := pc.checkProxy(ctx, proxy, proxyTypes)
+    println(result.Type, valid)
 }
 
 func TestUpdateProxy(t *testing.T) {
@@ -0,0 +1,262 @@
+package proxychecker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newForwardProxy starts a plain HTTP forwarding proxy. rewrite, when not
+// nil, may alter each request before it is forwarded.
+func newForwardProxy(t *testing.T, rewrite func(*http.Request)) *httptest.Server {
+    srv := newUnstartedForwardProxy(t, rewrite)
+    srv.Start()
+    return srv
+}
+
+// newUnstartedForwardProxy is like newForwardProxy but leaves starting the
+// server to the caller, who can configure it first.
+func newUnstartedForwardProxy(t *testing.T, rewrite func(*http.Request)) *httptest.Server {
+    srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        out := r.Clone(r.Context())
+        out.RequestURI = ""
+        out.Header.Del("Proxy-Connection")
+        if rewrite != nil {
+            rewrite(out)
+        }
+        resp, err := http.DefaultTransport.RoundTrip(out)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadGateway)
+            return
+        }
+        defer resp.Body.Close()
+        for key, values := range resp.Header {
+            for _, value := range values {
+                w.Header().Add(key, value)
+            }
+        }
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+// newConnectProxy starts an HTTP proxy that only supports CONNECT. dial, when
+// not nil, chooses the address actually dialed for a requested target.
+func newConnectProxy(t *testing.T, dial func(target string) string) *httptest.Server {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodConnect {
+            http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+            return
+        }
+        target := r.Host
+        if dial != nil {
+            target = dial(target)
+        }
+        upstream, err := net.Dial("tcp", target)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadGateway)
+            return
+        }
+        conn, buf, err := w.(http.Hijacker).Hijack()
+        if err != nil {
+            upstream.Close()
+            return
+        }
+        conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+        go func() {
+            io.Copy(upstream, buf)
+            upstream.Close()
+        }()
+        io.Copy(conn, upstream)
+        conn.Close()
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+// socks5Server is a minimal in-process SOCKS5 server supporting CONNECT,
+// UDP ASSOCIATE and, when username is set, RFC 1929 authentication. Host
+// names are looked up in hosts first, standing in for DNS only the proxy
+// can see; with noDomain set they are refused altogether.
+type socks5Server struct {
+    ln       net.Listener
+    username string
+    password string
+    hosts    map[string]string
+    noDomain bool
+}
+
+func newSocks5Server(t *testing.T, username, password string) *socks5Server {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &socks5Server{ln: ln, username: username, password: password}
+    go func() {
+        for {
+            conn, err := ln.Accept()
+            if err != nil {
+                return
+            }
+            go s.handle(conn)
+        }
+    }()
+    t.Cleanup(func() { ln.Close() })
+    return s
+}
+
+func (s *socks5Server) Addr() string {
+    return s.ln.Addr().String()
+}
+
+func (s *socks5Server) handle(conn net.Conn) {
+    defer conn.Close()
+    r := bufio.NewReader(conn)
+    var hdr [2]byte
+    if _, err := io.ReadFull(r, hdr[:]); err != nil || hdr[0] != 5 {
+        return
+    }
+    methods := make([]byte, hdr[1])
+    if _, err := io.ReadFull(r, methods); err != nil {
+        return
+    }
+    method := byte(0x00)
+    if s.username != "" {
+        method = 0x02
+    }
+    if !bytes.Contains(methods, []byte{method}) {
+        conn.Write([]byte{5, 0xff})
+        return
+    }
+    conn.Write([]byte{5, method})
+    if method == 0x02 {
+        var ver [2]byte
+        if _, err := io.ReadFull(r, ver[:]); err != nil {
+            return
+        }
+        user := make([]byte, ver[1])
+        io.ReadFull(r, user)
+        plen, _ := r.ReadByte()
+        pass := make([]byte, plen)
+        io.ReadFull(r, pass)
+        if string(user) != s.username || string(pass) != s.password {
+            conn.Write([]byte{1, 1})
+            return
+        }
+        conn.Write([]byte{1, 0})
+    }
+
+    var req [4]byte
+    if _, err := io.ReadFull(r, req[:]); err != nil || (req[1] != 0x01 && req[1] != 0x03) {
+        return
+    }
+    var host string
+    switch req[3] {
+    case 0x01:
+        ip := make([]byte, 4)
+        io.ReadFull(r, ip)
+        host = net.IP(ip).String()
+    case 0x04:
+        ip := make([]byte, 16)
+        io.ReadFull(r, ip)
+        host = net.IP(ip).String()
+    case 0x03:
+        n, _ := r.ReadByte()
+        name := make([]byte, n)
+        io.ReadFull(r, name)
+        host = string(name)
+        if s.noDomain {
+            conn.Write([]byte{5, 0x08, 0, 1, 0, 0, 0, 0, 0, 0})
+            return
+        }
+        if ip, ok := s.hosts[host]; ok {
+            host = ip
+        }
+    default:
+        return
+    }
+    var port [2]byte
+    if _, err := io.ReadFull(r, port[:]); err != nil {
+        return
+    }
+    if req[1] == 0x03 {
+        s.associate(conn)
+        return
+    }
+    target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))))
+    if err != nil {
+        conn.Write([]byte{5, 0x05, 0, 1, 0, 0, 0, 0, 0, 0})
+        return
+    }
+    defer target.Close()
+    conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+    go io.Copy(target, r)
+    io.Copy(conn, target)
+}
+
+// associate relays datagrams between the client and their targets until the
+// control connection closes.
+func (s *socks5Server) associate(ctrl net.Conn) {
+    relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+    if err != nil {
+        return
+    }
+    defer relay.Close()
+    bound := relay.LocalAddr().(*net.UDPAddr)
+    reply := []byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}
+    binary.BigEndian.PutUint16(reply[8:], uint16(bound.Port))
+    ctrl.Write(reply)
+
+    go func() {
+        buf := make([]byte, 1500)
+        var client *net.UDPAddr
+        for {
+            n, from, err := relay.ReadFromUDP(buf)
+            if err != nil {
+                return
+            }
+            if client == nil || from.String() == client.String() {
+                client = from
+                packet := bytes.NewReader(buf[3:n])
+                target, err := readSocks5Addr(packet)
+                if err != nil {
+                    continue
+                }
+                addr, err := net.ResolveUDPAddr("udp", target)
+                if err != nil {
+                    continue
+                }
+                payload, _ := io.ReadAll(packet)
+                relay.WriteToUDP(payload, addr)
+                continue
+            }
+            header, _ := encodeSocks5Addr("", from.IP, from.Port)
+            relay.WriteToUDP(append(append([]byte{0, 0, 0}, header...), buf[:n]...), client)
+        }
+    }()
+    io.Copy(io.Discard, ctrl)
+}
+
+// newJudge starts a judge answering "judge ok" on every path and returns
+// a Judge requiring that content.
+func newJudge(t *testing.T) Judge {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("judge ok"))
+    }))
+    t.Cleanup(srv.Close)
+    return Judge{URL: srv.URL, Contains: "judge ok"}
+}
+
+// proxyFor returns an http Proxy pointing at the given test server.
+func proxyFor(srv *httptest.Server) Proxy {
+    return Proxy{Address: strings.TrimPrefix(srv.URL, "http://"), Type: "http"}
+}
@@ -0,0 +1,99 @@
+package proxychecker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSocks5hTransport(t *testing.T) {
+    judge := newJudge(t)
+    judgeURL, _ := url.Parse(judge.URL)
+    port := judgeURL.Port()
+    srv := newSocks5Server(t, "user", "pass")
+    // judge.internal only resolves on the proxy side.
+    srv.hosts = map[string]string{"judge.internal": "127.0.0.1"}
+
+    for _, tt := range []struct {
+        scheme string
+        ok     bool
+    }{{"socks5h", true}, {"socks5", false}} {
+        p := Proxy{Address: srv.Addr(), Type: tt.scheme, Username: "user", Password: "pass"}
+        transport, err := p.Transport()
+        if err != nil {
+            t.Fatal(err)
+        }
+        client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+        resp, err := client.Get("http://judge.internal:" + port + "/")
+        if err == nil {
+            resp.Body.Close()
+        }
+        if (err == nil) != tt.ok {
+            t.Errorf("%s: got error %v, want ok=%v", tt.scheme, err, tt.ok)
+        }
+        transport.CloseIdleConnections()
+    }
+}
+
+func TestProbeRemoteDNS(t *testing.T) {
+    target := listen(t, func(conn net.Conn) { conn.Close() })
+    _, port, _ := net.SplitHostPort(target)
+    resolving := newSocks5Server(t, "", "")
+    resolving.hosts = map[string]string{"target.internal": "127.0.0.1"}
+    refusing := newSocks5Server(t, "", "")
+    refusing.noDomain = true
+    // Resolves target.internal itself, failing on any other name.
+    connect := newConnectProxy(t, func(target string) string {
+        if target == net.JoinHostPort("target.internal", port) {
+            return net.JoinHostPort("127.0.0.1", port)
+        }
+        return net.JoinHostPort("unresolvable.invalid", port)
+    })
+
+    pc := NewProxyChecker()
+    pc.CapabilityTargets.RemoteDNSAddr = net.JoinHostPort("target.internal", port)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tests := []struct {
+        name  string
+        proxy Proxy
+        want  bool
+    }{
+        {"socks5 resolving", Proxy{Address: resolving.Addr(), Type: "socks5"}, true},
+        {"socks5 without domain support", Proxy{Address: refusing.Addr(), Type: "socks5"}, false},
+        {"http connect", proxyFor(connect), true},
+        {"http against a socks server", Proxy{Address: resolving.Addr(), Type: "http"}, false},
+    }
+    for _, tt := range tests {
+        caps := pc.probeCapabilities(ctx, tt.proxy)
+        if got := caps.Has(CapRemoteDNS); got != tt.want {
+            t.Errorf("%s: got remote DNS %v, want %v", tt.name, got, tt.want)
+        }
+    }
+
+    socks4 := newSocks4Server(t, false)
+    pc.CapabilityTargets.RemoteDNSAddr = net.JoinHostPort("localhost", port)
+    if !pc.probeCapabilities(ctx, Proxy{Address: socks4.Addr(), Type: "socks4"}).Has(CapRemoteDNS) {
+        t.Error("socks4a capable proxy not detected")
+    }
+}
+
+func TestWithRemoteDNS(t *testing.T) {
+    tests := []struct {
+        in   Proxy
+        want string
+    }{
+        {Proxy{Address: "1.2.3.4:1080", Type: "socks5", Username: "u", Password: "p"}, "socks5h://u:p@1.2.3.4:1080"},
+        {Proxy{Address: "socks4://1.2.3.4:1080", Type: "socks4"}, "socks4a://1.2.3.4:1080"},
+        {Proxy{Address: "1.2.3.4:8080", Type: "http"}, "http://1.2.3.4:8080"},
+    }
+    for _, tt := range tests {
+        if got := tt.in.WithRemoteDNS().URL(); got != tt.want {
+            t.Errorf("%+v: got %s, want %s", tt.in, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,272 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// FailureCategory classifies why a proxy failed its check.
+type FailureCategory string
+
+const (
+    FailureInvalidAddress FailureCategory = "invalid-address"
+    FailureNotListening   FailureCategory = "not-listening"
+    FailureRefused        FailureCategory = "refused"
+    FailureTimeout        FailureCategory = "timeout"
+    FailureReset          FailureCategory = "reset"
+    FailureDNS            FailureCategory = "dns"
+    // FailureResource means we ran out of descriptors or ports locally.
+    FailureResource FailureCategory = "local-resource"
+    FailureTLS      FailureCategory = "tls"
+    // FailureProtocol means the proxy did not speak the protocol properly,
+    // e.g. a rejected SOCKS handshake or a malformed HTTP response.
+    FailureProtocol  FailureCategory = "protocol"
+    FailureProxyAuth FailureCategory = "proxy-auth"
+    FailureStatus    FailureCategory = "status"
+    // FailureContent means the judge answered but the body was not genuine.
+    FailureContent     FailureCategory = "content"
+    FailureTLSTampered FailureCategory = "tls-tampered"
+    FailureInjected    FailureCategory = "injected"
+    FailureUnreliable  FailureCategory = "unreliable"
+    FailureTarget      FailureCategory = "target"
+    FailureNoJudge     FailureCategory = "no-judge"
+    FailureCanceled    FailureCategory = "canceled"
+    FailureOther       FailureCategory = "other"
+)
+
+// CheckResult is the outcome of checking one proxy.
+type CheckResult struct {
+    Proxy Proxy
+    Good  bool
+    // Protocol is the protocol the proxy passed with or, for a failure, the
+    // one whose attempt got furthest.
+    Protocol string
+    // Failure and Err say why a proxy that is not Good was rejected.
+    Failure FailureCategory
+    Err     error
+    // StatusCode is the status of the judge response that failed the check,
+    // when there was one.
+    StatusCode int
+    // Timings are those of the passing request or of the failed attempt.
+    Timings Timings
+}
+
+// newCheckResult describes the outcome of checking p.
+func newCheckResult(p, result Proxy, good bool, err error) CheckResult {
+    if result.Type == "" && !good {
+        result = p
+    }
+    r := CheckResult{Proxy: result, Good: good, Protocol: result.Type, Err: err, Timings: result.Timings}
+    if good {
+        return r
+    }
+    var protoErr *protocolError
+    if errors.As(err, &protoErr) {
+        r.Protocol = protoErr.protocol
+        r.Timings = protoErr.timings
+    }
+    var respErr *responseError
+    if errors.As(err, &respErr) {
+        r.StatusCode = respErr.status
+    }
+    r.Failure = classify(err)
+    return r
+}
+
+// classify maps an error from a check to its FailureCategory.
+func classify(err error) FailureCategory {
+    var respErr *responseError
+    var dnsErr *net.DNSError
+    var netErr net.Error
+    var urlErr *url.Error
+    var unknownAuthority x509.UnknownAuthorityError
+    var certInvalid x509.CertificateInvalidError
+    var hostname x509.HostnameError
+    var recordHeader tls.RecordHeaderError
+    switch {
+    case err == nil:
+        return ""
+    case errors.Is(err, errInvalidFormat):
+        return FailureInvalidAddress
+    case errors.Is(err, errNotListening):
+        return FailureNotListening
+    case errors.Is(err, errNoJudge):
+        return FailureNoJudge
+    case errors.Is(err, errTLSTampered):
+        return FailureTLSTampered
+    case errors.Is(err, errInjected):
+        return FailureInjected
+    case errors.Is(err, errUnreliable):
+        return FailureUnreliable
+    case errors.Is(err, errNoTarget):
+        return FailureTarget
+    case errors.As(err, &respErr):
+        if respErr.content {
+            return FailureContent
+        }
+        if respErr.status == 407 {
+            return FailureProxyAuth
+        }
+        return FailureStatus
+    case errors.Is(err, context.Canceled):
+        return FailureCanceled
+    case isResourceError(err):
+        return FailureResource
+    case errors.As(err, &dnsErr):
+        return FailureDNS
+    case isRefusedError(err):
+        return FailureRefused
+    case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+        return FailureTimeout
+    case errors.As(err, &unknownAuthority), errors.As(err, &certInvalid), errors.As(err, &hostname),
+        errors.As(err, &recordHeader):
+        return FailureTLS
+    case isResetError(err), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+        return FailureReset
+    case errors.As(err, &urlErr):
+        return FailureProtocol
+    }
+    return FailureOther
+}
+
+// progress ranks how far a failed attempt got, so the most telling of the
+// per-protocol failures is the one reported.
+func progress(err error) int {
+    switch classify(err) {
+    case FailureContent, FailureStatus, FailureProxyAuth, FailureTarget:
+        return 3
+    case FailureTLS:
+        return 2
+    case FailureProtocol, FailureReset:
+        return 1
+    }
+    return 0
+}
+
+// CheckProxy checks a single proxy with the configured Checker, adds it to
+// the pool when it is good and reports the outcome.
+func (pc *ProxyChecker) CheckProxy(ctx context.Context, p Proxy) CheckResult {
+    ctx, cancel, ok := pc.begin(ctx)
+    if !ok {
+        return newCheckResult(p, Proxy{}, false, ErrClosed)
+    }
+    defer cancel()
+    return pc.checkOne(ctx, p)
+}
+
+func (pc *ProxyChecker) checkOne(ctx context.Context, p Proxy) CheckResult {
+    result, err := pc.checker().Check(ctx, p)
+    if err == nil && pc.GeoIP != nil {
+        result = pc.locate(ctx, result)
+    }
+    result, good := pc.record(p, result, err)
+    if good {
+        fullAddress := fmt.Sprintf("%s://%s", result.Type, p.hostPort())
+        result.Address = fullAddress
+        pc.Proxies.Store(fullAddress, result)
+    }
+    return newCheckResult(p, result, good, err)
+}
+
+// RunStats aggregates the results of a run of checks.
+type RunStats struct {
+    Started  time.Time
+    Duration time.Duration
+    Checked  int
+    Good     int
+    // Protocols counts the good proxies by protocol.
+    Protocols map[string]int
+    // Failures counts the bad proxies by failure category.
+    Failures map[FailureCategory]int
+    // TotalLatency sums the total check time of the good proxies.
+    TotalLatency time.Duration
+}
+
+// AverageLatency is the mean total check time of the good proxies.
+func (s RunStats) AverageLatency() time.Duration {
+    if s.Good == 0 {
+        return 0
+    }
+    return s.TotalLatency / time.Duration(s.Good)
+}
+
+// runStats collects RunStats while a run is going.
+type runStats struct {
+    mu    sync.Mutex
+    stats RunStats
+    done  bool
+}
+
+func newRunStats() *runStats {
+    return &runStats{stats: RunStats{
+        Started:   time.Now(),
+        Protocols: map[string]int{},
+        Failures:  map[FailureCategory]int{},
+    }}
+}
+
+func (s *runStats) add(r CheckResult) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.stats.Checked++
+    if r.Good {
+        s.stats.Good++
+        s.stats.Protocols[r.Protocol]++
+        s.stats.TotalLatency += r.Timings.Total
+    } else {
+        s.stats.Failures[r.Failure]++
+    }
+}
+
+func (s *runStats) finish() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.stats.Duration = time.Since(s.stats.Started)
+    s.done = true
+}
+
+func (s *runStats) snapshot() RunStats {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    stats := s.stats
+    if !s.done {
+        stats.Duration = time.Since(stats.Started)
+    }
+    stats.Protocols = make(map[string]int, len(s.stats.Protocols))
+    for protocol, n := range s.stats.Protocols {
+        stats.Protocols[protocol] = n
+    }
+    stats.Failures = make(map[FailureCategory]int, len(s.stats.Failures))
+    for category, n := range s.stats.Failures {
+        stats.Failures[category] = n
+    }
+    return stats
+}
+
+// startRunStats begins collecting the statistics of a new run.
+func (pc *ProxyChecker) startRunStats() *runStats {
+    stats := newRunStats()
+    pc.controllerLock.Lock()
+    pc.runStats = stats
+    pc.controllerLock.Unlock()
+    return stats
+}
+
+// RunStats returns the statistics of the running or last run of checks.
+func (pc *ProxyChecker) RunStats() RunStats {
+    pc.controllerLock.Lock()
+    stats := pc.runStats
+    pc.controllerLock.Unlock()
+    if stats == nil {
+        return RunStats{}
+    }
+    return stats.snapshot()
+}
@@ -0,0 +1,88 @@
+package proxychecker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckResultClassification(t *testing.T) {
+    judge := newJudge(t)
+    statusProxy := func(code int) Proxy {
+        srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(code)
+            w.Write([]byte("judge ok"))
+        }))
+        t.Cleanup(srv.Close)
+        return proxyFor(srv)
+    }
+    portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("please log in"))
+    }))
+    defer portal.Close()
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    closedAddr := ln.Addr().String()
+    ln.Close()
+    silent := listen(t, func(conn net.Conn) {
+        time.Sleep(2 * time.Second)
+        conn.Close()
+    })
+
+    tests := []struct {
+        name    string
+        proxy   Proxy
+        good    bool
+        failure FailureCategory
+        status  int
+    }{
+        {"good", proxyFor(newForwardProxy(t, nil)), true, "", 0},
+        {"content", proxyFor(portal), false, FailureContent, 200},
+        {"forbidden", statusProxy(http.StatusForbidden), false, FailureStatus, 403},
+        {"auth", statusProxy(http.StatusProxyAuthRequired), false, FailureProxyAuth, 407},
+        {"refused", Proxy{Address: closedAddr, Type: "http"}, false, FailureRefused, 0},
+        {"timeout", Proxy{Address: silent, Type: "http"}, false, FailureTimeout, 0},
+        {"invalid", Proxy{Address: "1.2.3.4", Type: "http"}, false, FailureInvalidAddress, 0},
+    }
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{judge}
+    pc.Client.Timeout = 300 * time.Millisecond
+    defer pc.Close()
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result := pc.CheckProxy(context.Background(), tt.proxy)
+            if result.Good != tt.good || result.Failure != tt.failure || result.StatusCode != tt.status {
+                t.Errorf("got good=%v failure=%q status=%d (%v), want good=%v failure=%q status=%d",
+                    result.Good, result.Failure, result.StatusCode, result.Err, tt.good, tt.failure, tt.status)
+            }
+            if result.Protocol != "http" {
+                t.Errorf("got protocol %q, want http", result.Protocol)
+            }
+            if tt.good && (result.Timings.Total == 0 || !strings.HasPrefix(result.Proxy.Address, "http://")) {
+                t.Errorf("incomplete good result %+v", result)
+            }
+        })
+    }
+
+    var proxies []Proxy
+    for _, tt := range tests {
+        proxies = append(proxies, tt.proxy)
+    }
+    for range pc.StreamProxies(context.Background(), proxies) {
+    }
+    stats := pc.RunStats()
+    if stats.Checked != len(tests) || stats.Good != 1 || stats.Protocols["http"] != 1 {
+        t.Errorf("unexpected run stats %+v", stats)
+    }
+    for _, tt := range tests[1:] {
+        if stats.Failures[tt.failure] != 1 {
+            t.Errorf("got %d %q failures, want 1", stats.Failures[tt.failure], tt.failure)
+        }
+    }
+}
@@ -0,0 +1,69 @@
+package proxychecker
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// sampleReliability repeats the check of a proxy that already passed once
+// until pc.Samples requests were made in total, rotating through the judges
+// for scheme other than first, or checking the targets again when Targets
+// are configured. It returns the share of successful requests and the
+// difference between the slowest and the fastest one.
+func (pc *ProxyChecker) sampleReliability(ctx context.Context, p Proxy, scheme string, first Judge, firstTotal time.Duration) (float64, time.Duration) {
+    var judges []Judge
+    for _, judge := range pc.judgesFor(scheme) {
+        if judge.URL != first.URL {
+            judges = append(judges, judge)
+        }
+    }
+    if len(judges) == 0 {
+        judges = []Judge{first}
+    }
+    rand.Shuffle(len(judges), func(i, j int) {
+        judges[i], judges[j] = judges[j], judges[i]
+    })
+
+    successes := 1
+    fastest, slowest := firstTotal, firstTotal
+    for i := 0; i < pc.Samples-1; i++ {
+        if ctx.Err() != nil {
+            break
+        }
+        var total time.Duration
+        var err error
+        if len(pc.Targets) > 0 {
+            var report *TargetReport
+            report, err = pc.checkTargets(ctx, p)
+            total = report.fastest()
+        } else {
+            var timings Timings
+            timings, _, err = pc.probe(ctx, p, p.Type, judges[i%len(judges)])
+            total = timings.Total
+        }
+        if err != nil {
+            continue
+        }
+        successes++
+        if total < fastest {
+            fastest = total
+        }
+        if total > slowest {
+            slowest = total
+        }
+    }
+    return float64(successes) / float64(pc.Samples), slowest - fastest
+}
+
+// GetProxiesByReliability returns the cached proxies whose success ratio is
+// at least minRatio. Proxies checked without sampling are never returned.
+func (pc *ProxyChecker) GetProxiesByReliability(minRatio float64) []Proxy {
+    var proxies []Proxy
+    for _, proxy := range pc.GetAllProxies() {
+        if proxy.SuccessRatio > 0 && proxy.SuccessRatio >= minRatio {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
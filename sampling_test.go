@@ -0,0 +1,51 @@
+package proxychecker
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSampledCheck(t *testing.T) {
+    judge := newJudge(t)
+
+    // Every second request through the flaky proxy is sent to a dead port.
+    var requests int32
+    flaky := proxyFor(newForwardProxy(t, func(r *http.Request) {
+        if atomic.AddInt32(&requests, 1)%2 == 0 {
+            r.URL.Host = "127.0.0.1:1"
+        }
+    }))
+
+    tests := []struct {
+        minRatio float64
+        valid    bool
+    }{
+        {0.5, true},
+        {0.8, false},
+    }
+    for _, tt := range tests {
+        atomic.StoreInt32(&requests, 0)
+        pc := NewProxyChecker()
+        pc.Judges = []Judge{
+            {URL: judge.URL + "/a", Contains: judge.Contains},
+            {URL: judge.URL + "/b", Contains: judge.Contains},
+        }
+        pc.Samples = 4
+        pc.MinSuccessRatio = tt.minRatio
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        result, valid := pc.checkProxy(ctx, flaky, []string{"http"})
+        cancel()
+        if valid != tt.valid {
+            t.Errorf("min ratio %v: got valid=%v, want %v", tt.minRatio, valid, tt.valid)
+        }
+        if result.SuccessRatio != 0.5 {
+            t.Errorf("min ratio %v: got success ratio %v, want 0.5", tt.minRatio, result.SuccessRatio)
+        }
+        if cached := len(pc.GetAllProxies()) == 1; cached != tt.valid {
+            t.Errorf("min ratio %v: got cached=%v, want %v", tt.minRatio, cached, tt.valid)
+        }
+    }
+}
@@ -3,6 +3,7 @@ package proxychecker
 import (
 	"context"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"sync"
@@ -10,6 +11,16 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
+// proxyRegexp finds proxies in free-form text: an IPv4 address, a bracketed
+// IPv6 literal or a host name with a port, optionally with credentials in
+// user:pass@host:port form. The host:port:user:pass form ParseProxy accepts
+// is left out on purpose: on scraped pages whatever follows the port is
+// usually a country or an anonymity level, not credentials.
+var proxyRegexp = regexp.MustCompile(
+    `([^\s:@/"'<>\[\]]+:[^\s:@/"'<>\[\]]+@)?` +
+        `(\d{1,3}(\.\d{1,3}){3}|\[[0-9A-Fa-f:.]+\]|([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+[A-Za-z]{2,63})` +
+        `:\d{1,5}`)
+
 func (pc *ProxyChecker) scrapeProxies(ctx context.Context) ([]Proxy, error) {
     var wg sync.WaitGroup
     var mu sync.Mutex
@@ -52,14 +63,12 @@ func (pc *ProxyChecker) scrapeProxy(ctx context.Context, url string) ([]Proxy, e
     if err != nil {
 		return nil, err
 	}
-    proxyPattern := `(\d{1,3}(\.\d{1,3}){3}:\d{1,5})`
-    r := regexp.MustCompile(proxyPattern)
-    matches := r.FindAllString(bodyString, -1)
+    matches := proxyRegexp.FindAllString(bodyString, -1)
     if matches != nil {
         proxies := make([]Proxy, 0, len(matches))
         for _, match := range matches {
-            if isValidProxyFormat(match) {
-                proxies = append(proxies, Proxy{Address: match})
+            if proxy, err := ParseProxy(match); err == nil {
+                proxies = append(proxies, proxy)
             }
         }
         if len(proxies) > 0 {
@@ -91,14 +100,23 @@ func (pc *ProxyChecker) scrapeProxiesFromHTML(doc *goquery.Document) []Proxy {
 
 			if rowIndex > 0 {
 				proxy := Proxy{}
+				host, port := "", ""
 				for i, cell := range row {
+					if i >= len(headers) {
+						break
+					}
 					header := strings.ToLower(headers[i])
-					if strings.Contains(header, "ip") || strings.Contains(header, "address") {
-						proxy.Address = cell
+					if strings.Contains(header, "ip") || strings.Contains(header, "address") || strings.Contains(header, "host") {
+						host = strings.Trim(cell, "[]")
 					} else if strings.Contains(header, "port") {
-						proxy.Address += ":" + cell
+						port = cell
 					}
 				}
+				if host != "" && port != "" {
+					proxy.Address = net.JoinHostPort(host, port)
+				} else {
+					proxy.Address = host
+				}
 				if proxy.Address != "" && isValidProxyFormat(proxy.Address){
 					proxies = append(proxies, proxy)
 				}
@@ -0,0 +1,35 @@
+package proxychecker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScrapeProxy(t *testing.T) {
+    list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("1.2.3.4:8080\n[2001:db8::1]:1080\nproxy.example.net:3128\nuser:pass@5.6.7.8:80\n9.9.9.9:3128:US:anonymous\n999.1.1.1:99999\n"))
+    }))
+    defer list.Close()
+    pc := NewProxyChecker()
+    proxies, err := pc.scrapeProxy(context.Background(), list.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"1.2.3.4:8080", "[2001:db8::1]:1080", "proxy.example.net:3128", "5.6.7.8:80", "9.9.9.9:3128"}
+    if len(proxies) != len(want) {
+        t.Fatalf("got %+v, want %v", proxies, want)
+    }
+    for i, p := range proxies {
+        if p.Address != want[i] {
+            t.Errorf("proxy %d = %q, want %q", i, p.Address, want[i])
+        }
+    }
+    if proxies[3].Username != "user" {
+        t.Errorf("credentials not scraped: %+v", proxies[3])
+    }
+    if proxies[4].Username != "" || proxies[4].Password != "" {
+        t.Errorf("list columns taken for credentials: %+v", proxies[4])
+    }
+}
@@ -0,0 +1,78 @@
+package proxychecker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+var (
+    // sniffGreeting is a SOCKS5 greeting followed by an empty line. SOCKS5
+    // servers answer the greeting and HTTP proxies reject the line as a
+    // malformed request, so one round trip tells them apart.
+    sniffGreeting = []byte{socks5Version, 0x01, socks5NoAuth, '\r', '\n', '\r', '\n'}
+    // sniffSocks4Request asks for a connection to 127.0.0.1:80. A SOCKS4
+    // server replies with a status byte whether or not it grants it.
+    sniffSocks4Request = []byte{socks4Version, socks4CmdConnect, 0, 80, 127, 0, 0, 1, 0}
+)
+
+// sniffProtocol tells the protocol of a proxy from the bytes it answers a
+// greeting with. SOCKS5 and HTTP proxies are identified on one connection,
+// a second one is needed only when the first was closed on us, as SOCKS4
+// servers do. A proxy that just stays silent is not asked again, so it
+// costs at most one SniffTimeout. It returns "" when the protocol could not
+// be identified.
+func (pc *ProxyChecker) sniffProtocol(ctx context.Context, p Proxy) string {
+    reply, closed := pc.sniff(ctx, p, sniffGreeting)
+    switch {
+    case len(reply) >= 2 && reply[0] == socks5Version:
+        return "socks5"
+    case bytes.HasPrefix(reply, []byte("HTTP/")):
+        return "http"
+    case isSocks4Reply(reply):
+        return "socks4"
+    }
+    if !closed {
+        return ""
+    }
+    if reply, _ := pc.sniff(ctx, p, sniffSocks4Request); isSocks4Reply(reply) {
+        return "socks4"
+    }
+    return ""
+}
+
+// sniff sends greeting on a new connection and returns the start of the
+// reply. closed tells whether the proxy accepted the connection but closed
+// or reset it before replying in full, rather than timing out.
+func (pc *ProxyChecker) sniff(ctx context.Context, p Proxy, greeting []byte) (reply []byte, closed bool) {
+    timeout := pc.SniffTimeout
+    if timeout <= 0 {
+        timeout = pc.Client.Timeout
+    }
+    dialer := &net.Dialer{Timeout: timeout}
+    conn, err := dialer.DialContext(ctx, "tcp", p.hostPort())
+    if err != nil {
+        return nil, false
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(timeout))
+    defer interruptOnDone(ctx, conn)()
+    if _, err = conn.Write(greeting); err == nil {
+        reply = make([]byte, 8)
+        var n int
+        n, err = io.ReadAtLeast(conn, reply, 2)
+        reply = reply[:n]
+    }
+    if err == nil || ctx.Err() != nil {
+        return reply, false
+    }
+    var netErr net.Error
+    return reply, !(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func isSocks4Reply(reply []byte) bool {
+    return len(reply) >= 2 && reply[0] == 0x00 && reply[1] >= socks4Granted && reply[1] <= 0x5d
+}
@@ -0,0 +1,77 @@
+package proxychecker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSniffProtocol(t *testing.T) {
+    silent := listen(t, func(conn net.Conn) {
+        time.Sleep(time.Second)
+        conn.Close()
+    })
+    tests := []struct {
+        name    string
+        address string
+        want    string
+    }{
+        {"http", strings.TrimPrefix(newForwardProxy(t, nil).URL, "http://"), "http"},
+        {"socks5", newSocks5Server(t, "", "").Addr(), "socks5"},
+        {"socks5 with auth", newSocks5Server(t, "user", "pass").Addr(), "socks5"},
+        {"socks4", newSocks4Server(t, false).Addr(), "socks4"},
+        {"silent", silent, ""},
+    }
+    pc := NewProxyChecker()
+    pc.SniffTimeout = 300 * time.Millisecond
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            start := time.Now()
+            if got := pc.sniffProtocol(context.Background(), Proxy{Address: tt.address}); got != tt.want {
+                t.Errorf("got %q, want %q", got, tt.want)
+            }
+            // Only a proxy closing the connection is asked a second time.
+            if elapsed := time.Since(start); elapsed > pc.SniffTimeout*3/2 {
+                t.Errorf("sniffing took %s with a %s timeout", elapsed, pc.SniffTimeout)
+            }
+        })
+    }
+}
+
+func TestSniffingSavesConnections(t *testing.T) {
+    judge := newJudge(t)
+    proxy := newUnstartedForwardProxy(t, nil)
+    var conns int32
+    proxy.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+        if state == http.StateNew {
+            atomic.AddInt32(&conns, 1)
+        }
+    }
+    proxy.Start()
+    address := strings.TrimPrefix(proxy.URL, "http://")
+
+    for _, sniff := range []bool{false, true} {
+        atomic.StoreInt32(&conns, 0)
+        pc := NewProxyChecker()
+        pc.Judges = []Judge{judge}
+        pc.SniffProtocols = sniff
+        result := pc.CheckProxy(context.Background(), Proxy{Address: address})
+        if !result.Good || result.Protocol != "http" {
+            t.Fatalf("sniff=%v: %+v", sniff, result)
+        }
+        pc.Close()
+        // One connection to sniff and one for the HTTP check, against one
+        // per protocol in proxyTypes.
+        want := int32(len(proxyTypes))
+        if sniff {
+            want = 2
+        }
+        if got := atomic.LoadInt32(&conns); got != want {
+            t.Errorf("sniff=%v: got %d connections, want %d", sniff, got, want)
+        }
+    }
+}
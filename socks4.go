@@ -0,0 +1,125 @@
+package proxychecker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+    socks4Version        = 0x04
+    socks4CmdConnect     = 0x01
+    socks4Granted        = 0x5a
+    socks4Rejected       = 0x5b
+    socks4NoIdentd       = 0x5c
+    socks4IdentdMismatch = 0x5d
+)
+
+// socks4Dialer dials TCP connections through a SOCKS4 or SOCKS4a proxy.
+// With remoteDNS set the target hostname is sent to the proxy (SOCKS4a),
+// otherwise it is resolved locally and only the IPv4 address is sent.
+type socks4Dialer struct {
+    proxyAddr string
+    userID    string
+    remoteDNS bool
+    forward   *net.Dialer
+}
+
+func newSocks4Dialer(proxyAddr, userID string, remoteDNS bool, timeout time.Duration) *socks4Dialer {
+    return &socks4Dialer{
+        proxyAddr: proxyAddr,
+        userID:    userID,
+        remoteDNS: remoteDNS,
+        forward:   &net.Dialer{Timeout: timeout},
+    }
+}
+
+func (d *socks4Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+    if network != "tcp" && network != "tcp4" {
+        return nil, fmt.Errorf("socks4: network %q not supported", network)
+    }
+    req, err := d.buildRequest(ctx, addr)
+    if err != nil {
+        return nil, err
+    }
+    conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddr)
+    if err != nil {
+        return nil, err
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+    defer interruptOnDone(ctx, conn)()
+    if err := socks4Handshake(conn, req); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return conn, nil
+}
+
+func (d *socks4Dialer) buildRequest(ctx context.Context, addr string) ([]byte, error) {
+    host, portStr, err := net.SplitHostPort(addr)
+    if err != nil {
+        return nil, err
+    }
+    port, err := strconv.Atoi(portStr)
+    if err != nil || port < 1 || port > 65535 {
+        return nil, fmt.Errorf("socks4: invalid port %q", portStr)
+    }
+    req := []byte{socks4Version, socks4CmdConnect, 0, 0}
+    binary.BigEndian.PutUint16(req[2:], uint16(port))
+
+    ip := net.ParseIP(host).To4()
+    if ip == nil && net.ParseIP(host) != nil {
+        return nil, errors.New("socks4: IPv6 targets are not supported")
+    }
+    if ip == nil && !d.remoteDNS {
+        ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+        if err != nil {
+            return nil, err
+        }
+        ip = ips[0].To4()
+    }
+    if ip != nil {
+        req = append(req, ip...)
+        req = append(req, d.userID...)
+        return append(req, 0), nil
+    }
+    // SOCKS4a: an address of 0.0.0.x with x != 0 tells the proxy that the
+    // hostname follows the user ID.
+    req = append(req, 0, 0, 0, 1)
+    req = append(req, d.userID...)
+    req = append(req, 0)
+    req = append(req, host...)
+    return append(req, 0), nil
+}
+
+func socks4Handshake(conn net.Conn, req []byte) error {
+    if _, err := conn.Write(req); err != nil {
+        return err
+    }
+    var resp [8]byte
+    if _, err := io.ReadFull(conn, resp[:]); err != nil {
+        return err
+    }
+    if resp[0] != 0x00 {
+        return fmt.Errorf("socks4: unexpected reply version %d", resp[0])
+    }
+    switch resp[1] {
+    case socks4Granted:
+        return nil
+    case socks4Rejected:
+        return errors.New("socks4: request rejected or failed")
+    case socks4NoIdentd:
+        return errors.New("socks4: request rejected, identd unreachable")
+    case socks4IdentdMismatch:
+        return errors.New("socks4: request rejected, identd user mismatch")
+    default:
+        return fmt.Errorf("socks4: unknown reply code %d", resp[1])
+    }
+}
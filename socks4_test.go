@@ -0,0 +1,156 @@
+package proxychecker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socks4Server is a minimal in-process SOCKS4/SOCKS4a server used by the tests.
+type socks4Server struct {
+    ln     net.Listener
+    reject bool
+
+    mu       sync.Mutex
+    lastHost string
+    lastUser string
+}
+
+func newSocks4Server(t *testing.T, reject bool) *socks4Server {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &socks4Server{ln: ln, reject: reject}
+    go s.serve()
+    t.Cleanup(func() { ln.Close() })
+    return s
+}
+
+func (s *socks4Server) Addr() string {
+    return s.ln.Addr().String()
+}
+
+func (s *socks4Server) serve() {
+    for {
+        conn, err := s.ln.Accept()
+        if err != nil {
+            return
+        }
+        go s.handle(conn)
+    }
+}
+
+func (s *socks4Server) handle(conn net.Conn) {
+    defer conn.Close()
+    r := bufio.NewReader(conn)
+    var hdr [8]byte
+    // Like real servers, hang up as soon as the version is wrong.
+    if _, err := io.ReadFull(r, hdr[:1]); err != nil || hdr[0] != socks4Version {
+        return
+    }
+    if _, err := io.ReadFull(r, hdr[1:]); err != nil || hdr[1] != socks4CmdConnect {
+        return
+    }
+    user, err := r.ReadString(0)
+    if err != nil {
+        return
+    }
+    port := binary.BigEndian.Uint16(hdr[2:4])
+    host := net.IP(hdr[4:8]).String()
+    if hdr[4] == 0 && hdr[5] == 0 && hdr[6] == 0 && hdr[7] != 0 {
+        name, err := r.ReadString(0)
+        if err != nil {
+            return
+        }
+        host = name[:len(name)-1]
+    }
+    s.mu.Lock()
+    s.lastHost = host
+    s.lastUser = user[:len(user)-1]
+    s.mu.Unlock()
+
+    if s.reject {
+        conn.Write([]byte{0, socks4Rejected, 0, 0, 0, 0, 0, 0})
+        return
+    }
+    target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+    if err != nil {
+        conn.Write([]byte{0, socks4Rejected, 0, 0, 0, 0, 0, 0})
+        return
+    }
+    defer target.Close()
+    conn.Write([]byte{0, socks4Granted, 0, 0, 0, 0, 0, 0})
+    go io.Copy(target, r)
+    io.Copy(conn, target)
+}
+
+func (s *socks4Server) last() (string, string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.lastHost, s.lastUser
+}
+
+func TestSocks4Transport(t *testing.T) {
+    target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("ok"))
+    }))
+    defer target.Close()
+    targetURL, _ := url.Parse(target.URL)
+    _, port, _ := net.SplitHostPort(targetURL.Host)
+
+    tests := []struct {
+        scheme   string
+        host     string
+        wantHost string
+    }{
+        {"socks4", "127.0.0.1", "127.0.0.1"},
+        {"socks4", "localhost", "127.0.0.1"},
+        {"socks4a", "localhost", "localhost"},
+    }
+    for _, tt := range tests {
+        srv := newSocks4Server(t, false)
+        proxy := Proxy{Address: tt.scheme + "://tester@" + srv.Addr(), Type: tt.scheme}
+        transport, err := proxy.Transport()
+        if err != nil {
+            t.Fatalf("%s: %v", tt.scheme, err)
+        }
+        client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+        resp, err := client.Get("http://" + net.JoinHostPort(tt.host, port))
+        if err != nil {
+            t.Fatalf("%s via %s: %v", tt.scheme, tt.host, err)
+        }
+        body, _ := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        transport.CloseIdleConnections()
+        if string(body) != "ok" {
+            t.Errorf("%s: got body %q", tt.scheme, body)
+        }
+        host, user := srv.last()
+        if host != tt.wantHost {
+            t.Errorf("%s via %s: proxy saw host %q, want %q", tt.scheme, tt.host, host, tt.wantHost)
+        }
+        if user != "tester" {
+            t.Errorf("%s: proxy saw user ID %q", tt.scheme, user)
+        }
+    }
+}
+
+func TestSocks4Rejected(t *testing.T) {
+    srv := newSocks4Server(t, true)
+    dialer := newSocks4Dialer(srv.Addr(), "", false, 5*time.Second)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if _, err := dialer.DialContext(ctx, "tcp", "127.0.0.1:80"); err == nil {
+        t.Fatal("expected rejected request to fail")
+    }
+}
@@ -0,0 +1,247 @@
+package proxychecker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+    socks5Version        = 0x05
+    socks5NoAuth         = 0x00
+    socks5UserPass       = 0x02
+    socks5NoAcceptable   = 0xff
+    socks5CmdConnect     = 0x01
+    socks5CmdUDPAssoc    = 0x03
+    socks5AddrIPv4       = 0x01
+    socks5AddrDomain     = 0x03
+    socks5AddrIPv6       = 0x04
+)
+
+// socks5Dialer is a SOCKS5 client supporting RFC 1929 authentication,
+// CONNECT and UDP ASSOCIATE. With remoteDNS set hostnames are sent to the
+// proxy, otherwise they are resolved locally first.
+type socks5Dialer struct {
+    proxyAddr string
+    username  string
+    password  string
+    remoteDNS bool
+    forward   *net.Dialer
+}
+
+func newSocks5Dialer(proxyAddr, username, password string, remoteDNS bool, timeout time.Duration) *socks5Dialer {
+    return &socks5Dialer{
+        proxyAddr: proxyAddr,
+        username:  username,
+        password:  password,
+        remoteDNS: remoteDNS,
+        forward:   &net.Dialer{Timeout: timeout},
+    }
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+    if network != "tcp" && network != "tcp4" && network != "tcp6" {
+        return nil, fmt.Errorf("socks5: network %q not supported", network)
+    }
+    conn, err := d.connect(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer interruptOnDone(ctx, conn)()
+    if _, err := d.request(ctx, conn, socks5CmdConnect, addr); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return conn, nil
+}
+
+// associateUDP sets up a UDP relay. The returned control connection must
+// stay open for as long as the relay is used.
+func (d *socks5Dialer) associateUDP(ctx context.Context) (net.Conn, *net.UDPAddr, error) {
+    conn, err := d.connect(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer interruptOnDone(ctx, conn)()
+    bound, err := d.request(ctx, conn, socks5CmdUDPAssoc, "0.0.0.0:0")
+    if err != nil {
+        conn.Close()
+        return nil, nil, err
+    }
+    relay, err := net.ResolveUDPAddr("udp", bound)
+    if err != nil {
+        conn.Close()
+        return nil, nil, err
+    }
+    // Many servers answer with an unspecified address meaning "same host as
+    // the control connection".
+    if relay.IP.IsUnspecified() {
+        relay.IP = conn.RemoteAddr().(*net.TCPAddr).IP
+    }
+    return conn, relay, nil
+}
+
+// connect dials the proxy and negotiates the authentication method.
+func (d *socks5Dialer) connect(ctx context.Context) (net.Conn, error) {
+    conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddr)
+    if err != nil {
+        return nil, err
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+    stop := interruptOnDone(ctx, conn)
+    err = d.negotiate(conn)
+    stop()
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+    return conn, nil
+}
+
+func (d *socks5Dialer) negotiate(conn net.Conn) error {
+    methods := []byte{socks5NoAuth}
+    if d.username != "" {
+        methods = []byte{socks5UserPass}
+    }
+    greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+    if _, err := conn.Write(greeting); err != nil {
+        return err
+    }
+    var reply [2]byte
+    if _, err := io.ReadFull(conn, reply[:]); err != nil {
+        return err
+    }
+    if reply[0] != socks5Version {
+        return fmt.Errorf("socks5: unexpected reply version %d", reply[0])
+    }
+    switch reply[1] {
+    case socks5NoAuth:
+        return nil
+    case socks5UserPass:
+        if len(d.username) > 255 || len(d.password) > 255 {
+            return errors.New("socks5: credentials too long")
+        }
+        auth := []byte{0x01, byte(len(d.username))}
+        auth = append(auth, d.username...)
+        auth = append(auth, byte(len(d.password)))
+        auth = append(auth, d.password...)
+        if _, err := conn.Write(auth); err != nil {
+            return err
+        }
+        if _, err := io.ReadFull(conn, reply[:]); err != nil {
+            return err
+        }
+        if reply[1] != 0x00 {
+            return errors.New("socks5: authentication failed")
+        }
+        return nil
+    case socks5NoAcceptable:
+        return errors.New("socks5: no acceptable authentication method")
+    }
+    return fmt.Errorf("socks5: unsupported authentication method %d", reply[1])
+}
+
+// request sends a command for addr and returns the bound address from the reply.
+func (d *socks5Dialer) request(ctx context.Context, conn net.Conn, cmd byte, addr string) (string, error) {
+    encoded, err := d.encodeAddr(ctx, addr)
+    if err != nil {
+        return "", err
+    }
+    req := append([]byte{socks5Version, cmd, 0x00}, encoded...)
+    if _, err := conn.Write(req); err != nil {
+        return "", err
+    }
+    var hdr [3]byte
+    if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+        return "", err
+    }
+    if hdr[0] != socks5Version {
+        return "", fmt.Errorf("socks5: unexpected reply version %d", hdr[0])
+    }
+    if hdr[1] != 0x00 {
+        return "", fmt.Errorf("socks5: request failed with code %d", hdr[1])
+    }
+    return readSocks5Addr(conn)
+}
+
+func (d *socks5Dialer) encodeAddr(ctx context.Context, addr string) ([]byte, error) {
+    host, portStr, err := net.SplitHostPort(addr)
+    if err != nil {
+        return nil, err
+    }
+    port, err := strconv.Atoi(portStr)
+    if err != nil || port < 0 || port > 65535 {
+        return nil, fmt.Errorf("socks5: invalid port %q", portStr)
+    }
+    ip := net.ParseIP(host)
+    if ip == nil && !d.remoteDNS {
+        ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+        if err != nil {
+            return nil, err
+        }
+        ip = ips[0]
+    }
+    return encodeSocks5Addr(host, ip, port)
+}
+
+func encodeSocks5Addr(host string, ip net.IP, port int) ([]byte, error) {
+    var b []byte
+    if ip4 := ip.To4(); ip4 != nil {
+        b = append([]byte{socks5AddrIPv4}, ip4...)
+    } else if ip != nil {
+        b = append([]byte{socks5AddrIPv6}, ip.To16()...)
+    } else {
+        if len(host) > 255 {
+            return nil, errors.New("socks5: hostname too long")
+        }
+        b = append([]byte{socks5AddrDomain, byte(len(host))}, host...)
+    }
+    return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+func readSocks5Addr(r io.Reader) (string, error) {
+    var atyp [1]byte
+    if _, err := io.ReadFull(r, atyp[:]); err != nil {
+        return "", err
+    }
+    var host string
+    switch atyp[0] {
+    case socks5AddrIPv4, socks5AddrIPv6:
+        size := net.IPv4len
+        if atyp[0] == socks5AddrIPv6 {
+            size = net.IPv6len
+        }
+        ip := make([]byte, size)
+        if _, err := io.ReadFull(r, ip); err != nil {
+            return "", err
+        }
+        host = net.IP(ip).String()
+    case socks5AddrDomain:
+        var n [1]byte
+        if _, err := io.ReadFull(r, n[:]); err != nil {
+            return "", err
+        }
+        name := make([]byte, n[0])
+        if _, err := io.ReadFull(r, name); err != nil {
+            return "", err
+        }
+        host = string(name)
+    default:
+        return "", fmt.Errorf("socks5: unknown address type %d", atyp[0])
+    }
+    var port [2]byte
+    if _, err := io.ReadFull(r, port[:]); err != nil {
+        return "", err
+    }
+    return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
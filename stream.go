@@ -0,0 +1,45 @@
+package proxychecker
+
+import "context"
+
+// Stream refreshes the pool like GetGoodProxy does on an empty cache, but
+// sends the result for every proxy on the returned channel as soon as it is
+// known. Good proxies are added to the pool before they are sent, so they
+// can be taken right away. The channel is closed when the refresh is over;
+// it has to be drained unless ctx is cancelled. When the refresh fails as a
+// whole, for example because pc is closed or scraping failed, the last
+// result has an empty Proxy and the error in Err.
+func (pc *ProxyChecker) Stream(ctx context.Context) <-chan CheckResult {
+    results := make(chan CheckResult)
+    go func() {
+        defer close(results)
+        send := sendTo(ctx, results)
+        if err := pc.refresh(ctx, send); err != nil {
+            send(newCheckResult(Proxy{}, Proxy{}, false, err))
+        }
+    }()
+    return results
+}
+
+// StreamProxies is like Stream but checks the given proxies instead of
+// scraping the sources.
+func (pc *ProxyChecker) StreamProxies(ctx context.Context, proxies []Proxy) <-chan CheckResult {
+    results := make(chan CheckResult)
+    go func() {
+        defer close(results)
+        send := sendTo(ctx, results)
+        if err := pc.checkAll(ctx, proxies, nil, nil, send); err != nil {
+            send(newCheckResult(Proxy{}, Proxy{}, false, err))
+        }
+    }()
+    return results
+}
+
+func sendTo(ctx context.Context, results chan<- CheckResult) func(CheckResult) {
+    return func(result CheckResult) {
+        select {
+        case results <- result:
+        case <-ctx.Done():
+        }
+    }
+}
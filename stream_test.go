@@ -0,0 +1,67 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamProxies(t *testing.T) {
+    judge := newJudge(t)
+    portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("please log in"))
+    }))
+    defer portal.Close()
+
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{judge}
+    good := proxyFor(newForwardProxy(t, nil))
+    bad := proxyFor(portal)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    results := map[string]CheckResult{}
+    for result := range pc.StreamProxies(ctx, []Proxy{good, bad, {Address: "not a proxy", Type: "http"}}) {
+        results[result.Proxy.hostPort()] = result
+        if result.Good {
+            // Good proxies are usable while the run is still going.
+            if len(pc.GetAllProxies()) == 0 {
+                t.Error("good proxy not in the pool when it was streamed")
+            }
+        }
+    }
+    if len(results) != 3 {
+        t.Fatalf("got %d results, want 3", len(results))
+    }
+    if r := results[good.Address]; !r.Good || r.Err != nil || r.Proxy.Address != "http://"+good.Address {
+        t.Errorf("good proxy: %+v", r)
+    }
+    if r := results[bad.Address]; r.Good || !errors.Is(r.Err, errNoProtocol) {
+        t.Errorf("bad proxy: %+v", r)
+    }
+    if r := results["not a proxy"]; r.Good || !errors.Is(r.Err, errInvalidFormat) {
+        t.Errorf("malformed proxy: %+v", r)
+    }
+}
+
+func TestStreamReportsFailedRun(t *testing.T) {
+    pc := NewProxyChecker()
+    pc.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    for name, results := range map[string]<-chan CheckResult{
+        "Stream":        pc.Stream(ctx),
+        "StreamProxies": pc.StreamProxies(ctx, []Proxy{{Address: "127.0.0.1:1"}}),
+    } {
+        var got []CheckResult
+        for result := range results {
+            got = append(got, result)
+        }
+        if len(got) != 1 || got[0].Proxy != (Proxy{}) || !errors.Is(got[0].Err, ErrClosed) {
+            t.Errorf("%s on a closed checker sent %+v, want one result with ErrClosed", name, got)
+        }
+    }
+}
@@ -0,0 +1,151 @@
+package proxychecker
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// TamperReport describes how a proxy altered a request on its way to the judge.
+type TamperReport struct {
+    // Added are headers the judge only received through the proxy.
+    Added []string
+    // Removed are headers we sent that never arrived through the proxy.
+    Removed []string
+    // Modified are headers we sent that arrived with a different value.
+    Modified         []string
+    UserAgentChanged bool
+    MethodChanged    bool
+    PathChanged      bool
+}
+
+// Tampered reports whether the proxy changed anything about the request.
+func (r TamperReport) Tampered() bool {
+    return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Modified) > 0 ||
+        r.UserAgentChanged || r.MethodChanged || r.PathChanged
+}
+
+const probeHeader = "X-Proxy-Checker-Probe"
+
+// analyzeTampering sends the same uniquely tagged request to an echo judge
+// directly and through the proxy, and compares what the judge received.
+// Comparing against the direct request keeps headers the judge's own
+// infrastructure adds out of the report. The direct request is only made
+// once per judge, see directEcho.
+func (pc *ProxyChecker) analyzeTampering(ctx context.Context, p Proxy) (TamperReport, error) {
+    judges := pc.TamperingJudges
+    if len(judges) == 0 {
+        judges = tamperingJudges
+    }
+    judge := judges[rand.Intn(len(judges))]
+
+    direct, err := pc.directEcho(ctx, judge)
+    if err != nil {
+        return TamperReport{}, err
+    }
+    transport, release, err := pc.transport(ctx, p)
+    if err != nil {
+        return TamperReport{}, err
+    }
+    defer release()
+    client := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+    }
+    proxied, err := pc.tamperingEcho(ctx, client, judge)
+    if err != nil {
+        return TamperReport{}, err
+    }
+    return compareEchoes(direct, proxied), nil
+}
+
+// directEcho returns what judge receives when it is asked without a proxy.
+// Results are cached per judge.
+func (pc *ProxyChecker) directEcho(ctx context.Context, judge string) (judgeEcho, error) {
+    pc.tamperingLock.Lock()
+    echo, ok := pc.directEchoes[judge]
+    pc.tamperingLock.Unlock()
+    if ok {
+        return echo, nil
+    }
+    echo, err := pc.tamperingEcho(ctx, pc.Client, judge)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    pc.tamperingLock.Lock()
+    if pc.directEchoes == nil {
+        pc.directEchoes = map[string]judgeEcho{}
+    }
+    pc.directEchoes[judge] = echo
+    pc.tamperingLock.Unlock()
+    return echo, nil
+}
+
+func (pc *ProxyChecker) tamperingEcho(ctx context.Context, client *http.Client, judge string) (judgeEcho, error) {
+    u, err := url.Parse(judge)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    query := u.Query()
+    query.Set("probe", strconv.FormatUint(rand.Uint64(), 16))
+    u.RawQuery = query.Encode()
+
+    req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    req.Header.Set(probeHeader, "1")
+    echo, err := pc.doJudgeEcho(client, req)
+    if err != nil {
+        return judgeEcho{}, err
+    }
+    // Only the nonce differs between the two requests; drop it so the
+    // paths can be compared.
+    if reported, err := url.Parse(echo.URL); err == nil {
+        q := reported.Query()
+        q.Del("probe")
+        reported.RawQuery = q.Encode()
+        echo.URL = reported.RequestURI()
+    }
+    return echo, nil
+}
+
+func compareEchoes(direct, proxied judgeEcho) TamperReport {
+    var report TamperReport
+    for name := range proxied.Headers {
+        if _, ok := direct.Headers[name]; !ok {
+            report.Added = append(report.Added, name)
+        }
+    }
+    for name, values := range direct.Headers {
+        got, ok := proxied.Headers[name]
+        if !ok {
+            report.Removed = append(report.Removed, name)
+        } else if len(values) > 0 && len(got) > 0 && got[0] != values[0] && !variesPerRequest(name) {
+            report.Modified = append(report.Modified, name)
+        }
+    }
+    sort.Strings(report.Added)
+    sort.Strings(report.Removed)
+    sort.Strings(report.Modified)
+    report.UserAgentChanged = direct.Headers.Get("User-Agent") != proxied.Headers.Get("User-Agent")
+    report.MethodChanged = direct.Method != proxied.Method
+    report.PathChanged = direct.URL != proxied.URL
+    return report
+}
+
+// variesPerRequest reports whether a judge sets the header itself to a new
+// value on every request, such as a load balancer trace ID.
+func variesPerRequest(name string) bool {
+    switch http.CanonicalHeaderKey(name) {
+    case "X-Amzn-Trace-Id", "X-Request-Id", "Cf-Ray", "X-Request-Start":
+        return true
+    }
+    return false
+}
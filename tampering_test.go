@@ -0,0 +1,78 @@
+package proxychecker
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeTampering(t *testing.T) {
+    judge := newEchoJudge(t)
+
+    tests := []struct {
+        name    string
+        rewrite func(*http.Request)
+        want    TamperReport
+    }{
+        {"honest", nil, TamperReport{}},
+        {"adds headers", func(r *http.Request) {
+            r.Header.Set("Via", "1.1 squid")
+            r.Header.Set("X-Proxy-Id", "42")
+        }, TamperReport{Added: []string{"Via", "X-Proxy-Id"}}},
+        {"rewrites user agent and strips language", func(r *http.Request) {
+            r.Header.Set("User-Agent", "SquidProxy/1.0")
+            r.Header.Del("Accept-Language")
+        }, TamperReport{Removed: []string{"Accept-Language"}, Modified: []string{"User-Agent"}, UserAgentChanged: true}},
+        {"changes method and path", func(r *http.Request) {
+            r.Method = http.MethodPost
+            r.URL.Path = "/other"
+        }, TamperReport{Added: []string{"Content-Length"}, MethodChanged: true, PathChanged: true}},
+    }
+    for _, tt := range tests {
+        pc := NewProxyChecker()
+        pc.TamperingJudges = []string{judge.URL + "/anything"}
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        report, err := pc.analyzeTampering(ctx, proxyFor(newForwardProxy(t, tt.rewrite)))
+        cancel()
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if !reflect.DeepEqual(report, tt.want) {
+            t.Errorf("%s: got %+v, want %+v", tt.name, report, tt.want)
+        }
+        if report.Tampered() != (tt.rewrite != nil) {
+            t.Errorf("%s: Tampered() = %v", tt.name, report.Tampered())
+        }
+    }
+}
+
+func TestTamperingBaselineCached(t *testing.T) {
+    judge := newEchoJudge(t)
+    var direct int32
+    pc := NewProxyChecker()
+    pc.Client.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+        atomic.AddInt32(&direct, 1)
+        return http.DefaultTransport.RoundTrip(r)
+    })
+    pc.TamperingJudges = []string{judge.URL + "/anything"}
+    for i := 0; i < 3; i++ {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        _, err := pc.analyzeTampering(ctx, proxyFor(newForwardProxy(t, nil)))
+        cancel()
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    if got := atomic.LoadInt32(&direct); got != 1 {
+        t.Errorf("judge was asked directly %d times, want 1", got)
+    }
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+    return f(r)
+}
@@ -0,0 +1,223 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errNoTarget = errors.New("proxy failed every target")
+
+// Target is a destination proxies are validated against instead of the
+// judges, for when what matters is whether a proxy works for one particular
+// site. Results are kept per target on Proxy.Targets.
+type Target struct {
+    // Name identifies the target in Proxy.Targets. It defaults to URL.
+    Name string
+    URL  string
+    // Method defaults to GET.
+    Method  string
+    Headers map[string]string
+    // StatusCodes are the accepted response codes, 200 when empty.
+    StatusCodes []int
+    // MustContain must all appear in the body and MustNotContain must not,
+    // e.g. a CAPTCHA marker or a "blocked" page.
+    MustContain    []string
+    MustNotContain []string
+}
+
+// TargetReport holds the outcome of checking a proxy against each Target,
+// keyed by target name.
+type TargetReport struct {
+    Results map[string]TargetResult
+}
+
+// Passed reports whether the proxy passed the named target. It is safe to
+// call on a nil report.
+func (r *TargetReport) Passed(target string) bool {
+    return r != nil && r.Results[target].Passed
+}
+
+// TargetResult is the outcome of checking a proxy against one Target.
+type TargetResult struct {
+    Passed     bool
+    StatusCode int
+    Latency    time.Duration
+    // Error says why the check failed.
+    Error string
+}
+
+func (t Target) name() string {
+    if t.Name != "" {
+        return t.Name
+    }
+    return t.URL
+}
+
+// validate checks a response against the target's success predicate.
+func (t Target) validate(resp *http.Response) error {
+    accepted := t.StatusCodes
+    if len(accepted) == 0 {
+        accepted = []int{http.StatusOK}
+    }
+    statusOK := false
+    for _, code := range accepted {
+        if resp.StatusCode == code {
+            statusOK = true
+            break
+        }
+    }
+    if !statusOK {
+        return fmt.Errorf("unexpected status %d", resp.StatusCode)
+    }
+    if len(t.MustContain) == 0 && len(t.MustNotContain) == 0 {
+        return nil
+    }
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+    if err != nil {
+        return err
+    }
+    for _, s := range t.MustContain {
+        if !strings.Contains(string(body), s) {
+            return fmt.Errorf("body does not contain %q", s)
+        }
+    }
+    for _, s := range t.MustNotContain {
+        if strings.Contains(string(body), s) {
+            return fmt.Errorf("body contains %q", s)
+        }
+    }
+    return nil
+}
+
+// checkTargets requests every configured target through the proxy. The
+// error is nil when at least one target passed, and otherwise the failure
+// that got furthest.
+func (pc *ProxyChecker) checkTargets(ctx context.Context, p Proxy) (*TargetReport, error) {
+    report := &TargetReport{Results: make(map[string]TargetResult, len(pc.Targets))}
+    var failure error
+    passed := false
+    for _, target := range pc.Targets {
+        result, err := pc.checkTarget(ctx, p, target)
+        report.Results[target.name()] = result
+        if err == nil {
+            passed = true
+        } else if failure == nil || progress(err) > progress(failure) {
+            failure = err
+        }
+    }
+    if passed {
+        return report, nil
+    }
+    return report, failure
+}
+
+func (pc *ProxyChecker) checkTarget(ctx context.Context, p Proxy, target Target) (TargetResult, error) {
+    var result TargetResult
+    fail := func(err error) (TargetResult, error) {
+        result.Error = err.Error()
+        return result, err
+    }
+    transport, release, err := pc.transport(ctx, p)
+    if err != nil {
+        return fail(err)
+    }
+    defer release()
+    client := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+    }
+    method := target.Method
+    if method == "" {
+        method = "GET"
+    }
+    req, err := http.NewRequestWithContext(ctx, method, target.URL, nil)
+    if err != nil {
+        return fail(err)
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    for key, value := range target.Headers {
+        req.Header.Set(key, value)
+    }
+    start := time.Now()
+    resp, err := client.Do(req)
+    if err != nil {
+        return fail(err)
+    }
+    defer resp.Body.Close()
+    result.StatusCode = resp.StatusCode
+    if err := target.validate(resp); err != nil {
+        result.Error = err.Error()
+        return result, fmt.Errorf("%w: %s: %v", errNoTarget, target.name(), err)
+    }
+    result.Latency = time.Since(start)
+    result.Passed = true
+    return result, nil
+}
+
+// fastest returns the latency of the fastest target passed.
+func (r *TargetReport) fastest() time.Duration {
+    var fastest time.Duration
+    for _, result := range r.Results {
+        if result.Passed && (fastest == 0 || result.Latency < fastest) {
+            fastest = result.Latency
+        }
+    }
+    return fastest
+}
+
+// capabilities returns what the targets passed prove about the proxy: an
+// https:// target needs a tunnel to port 443, an http:// one forwarding.
+func (r *TargetReport) capabilities(targets []Target) Capability {
+    var caps Capability
+    for _, target := range targets {
+        if !r.Passed(target.name()) {
+            continue
+        }
+        if strings.HasPrefix(strings.ToLower(target.URL), "https://") {
+            caps |= CapConnect443
+        } else {
+            caps |= CapHTTPForward
+        }
+    }
+    return caps
+}
+
+// passed returns the names of the targets that were passed, sorted.
+func (r *TargetReport) passed() []string {
+    if r == nil {
+        return nil
+    }
+    var names []string
+    for name, result := range r.Results {
+        if result.Passed {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+// GetProxiesFor returns the cached proxies that passed the named target.
+func (pc *ProxyChecker) GetProxiesFor(target string) []Proxy {
+    var proxies []Proxy
+    for _, proxy := range pc.GetAllProxies() {
+        if proxy.Targets.Passed(target) {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
+
+// GetGoodProxyFor is like GetGoodProxy but only hands out a proxy that
+// passed the named target.
+func (pc *ProxyChecker) GetGoodProxyFor(ctx context.Context, target string) (Proxy, error) {
+    return pc.takeProxy(ctx, func(p Proxy) bool { return p.Targets.Passed(target) })
+}
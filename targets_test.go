@@ -0,0 +1,68 @@
+package proxychecker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTargets(t *testing.T) {
+    judge := newJudge(t)
+    site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/search" && r.Header.Get("Via") != "" {
+            w.Write([]byte("<form id=captcha>"))
+            return
+        }
+        if r.Method == http.MethodHead && r.Header.Get("X-Api-Key") != "secret" {
+            w.WriteHeader(http.StatusForbidden)
+            return
+        }
+        w.WriteHeader(http.StatusAccepted)
+        w.Write([]byte("results"))
+    }))
+    defer site.Close()
+
+    pc := NewProxyChecker()
+    // Targets replace the judges, so a proxy that works for the site passes
+    // even when no judge does.
+    pc.Judges = []Judge{{URL: judge.URL, Contains: "never served"}}
+    pc.Targets = []Target{
+        {Name: "search", URL: site.URL + "/search", StatusCodes: []int{200, 202}, MustContain: []string{"results"}, MustNotContain: []string{"captcha"}},
+        {URL: site.URL + "/api", Method: http.MethodHead, Headers: map[string]string{"X-Api-Key": "secret"}, StatusCodes: []int{202}},
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    clean, valid := pc.checkProxy(ctx, proxyFor(newForwardProxy(t, nil)), []string{"http"})
+    if !valid || !clean.Targets.Passed("search") || !clean.Targets.Passed(site.URL+"/api") {
+        t.Fatalf("clean proxy: valid=%v targets=%+v", valid, clean.Targets)
+    }
+    if !clean.Capabilities.Has(CapHTTPForward) {
+        t.Errorf("clean proxy: got capabilities %v", clean.Capabilities)
+    }
+    banned, valid := pc.checkProxy(ctx, proxyFor(newForwardProxy(t, func(r *http.Request) {
+        r.Header.Set("Via", "1.1 proxy")
+    })), []string{"http"})
+    if !valid || banned.Targets.Passed("search") || !banned.Targets.Passed(site.URL+"/api") {
+        t.Fatalf("banned proxy: valid=%v targets=%+v", valid, banned.Targets)
+    }
+    if got := len(pc.GetProxiesFor("search")); got != 1 {
+        t.Errorf("got %d proxies for search, want 1", got)
+    }
+    if got := len(pc.GetProxiesFor(site.URL + "/api")); got != 2 {
+        t.Errorf("got %d proxies for api, want 2", got)
+    }
+
+    pc.Targets = pc.Targets[:1]
+    _, err := pc.runChecks(ctx, proxyFor(newForwardProxy(t, func(r *http.Request) {
+        r.Header.Set("Via", "1.1 proxy")
+    })), []string{"http"})
+    if err == nil {
+        t.Fatal("proxy failing every target must be rejected")
+    }
+    if got := classify(err); got != FailureTarget {
+        t.Errorf("got failure %s, want %s", got, FailureTarget)
+    }
+}
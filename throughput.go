@@ -0,0 +1,76 @@
+package proxychecker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+    defaultThroughputBytes  = 5 << 20
+    defaultThroughputBudget = 30 * time.Second
+)
+
+// measureThroughput downloads ThroughputURL through the proxy until
+// ThroughputMaxBytes are read or ThroughputBudget runs out, and returns the
+// body transfer rate in bytes per second.
+func (pc *ProxyChecker) measureThroughput(ctx context.Context, p Proxy) (float64, error) {
+    budget := pc.ThroughputBudget
+    if budget <= 0 {
+        budget = defaultThroughputBudget
+    }
+    limit := pc.ThroughputMaxBytes
+    if limit <= 0 {
+        limit = defaultThroughputBytes
+    }
+    ctx, cancel := context.WithTimeout(ctx, budget)
+    defer cancel()
+
+    transport, release, err := pc.transport(ctx, p)
+    if err != nil {
+        return 0, err
+    }
+    defer release()
+    client := &http.Client{Transport: transport}
+    req, err := http.NewRequestWithContext(ctx, "GET", pc.ThroughputURL, nil)
+    if err != nil {
+        return 0, err
+    }
+    for key, value := range pc.Headers {
+        req.Header.Set(key, value)
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return 0, fmt.Errorf("throughput payload returned %s", resp.Status)
+    }
+
+    start := time.Now()
+    n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, limit))
+    elapsed := time.Since(start)
+    // Running out of budget mid-download still leaves a usable measurement.
+    if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+        return 0, err
+    }
+    if n == 0 || elapsed <= 0 {
+        return 0, errors.New("no payload data received")
+    }
+    return float64(n) / elapsed.Seconds(), nil
+}
+
+// GetProxiesByThroughput returns the cached proxies ordered from the highest
+// to the lowest measured throughput.
+func (pc *ProxyChecker) GetProxiesByThroughput() []Proxy {
+    proxies := pc.GetAllProxies()
+    sort.SliceStable(proxies, func(i, j int) bool {
+        return proxies[i].Throughput > proxies[j].Throughput
+    })
+    return proxies
+}
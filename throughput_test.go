@@ -0,0 +1,65 @@
+package proxychecker
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMeasureThroughput(t *testing.T) {
+    const size = 1 << 20
+    payload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Length", strconv.Itoa(size))
+        w.Write(bytes.Repeat([]byte{'x'}, size))
+    }))
+    defer payload.Close()
+
+    pc := NewProxyChecker()
+    pc.ThroughputURL = payload.URL
+    pc.ThroughputMaxBytes = 64 << 10
+    rate, err := pc.measureThroughput(context.Background(), proxyFor(newForwardProxy(t, nil)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if rate <= 0 {
+        t.Errorf("got throughput %v, want > 0", rate)
+    }
+}
+
+func TestMeasureThroughputBudget(t *testing.T) {
+    // The payload never ends; the budget has to cut the download short.
+    payload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        chunk := bytes.Repeat([]byte{'x'}, 1024)
+        for {
+            if _, err := w.Write(chunk); err != nil {
+                return
+            }
+            w.(http.Flusher).Flush()
+            select {
+            case <-r.Context().Done():
+                return
+            case <-time.After(10 * time.Millisecond):
+            }
+        }
+    }))
+    defer payload.Close()
+
+    pc := NewProxyChecker()
+    pc.ThroughputURL = payload.URL
+    pc.ThroughputBudget = 300 * time.Millisecond
+    start := time.Now()
+    rate, err := pc.measureThroughput(context.Background(), proxyFor(newForwardProxy(t, nil)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if elapsed := time.Since(start); elapsed > 3*time.Second {
+        t.Errorf("measurement took %s, budget was %s", elapsed, pc.ThroughputBudget)
+    }
+    if rate <= 0 {
+        t.Errorf("got throughput %v, want > 0", rate)
+    }
+}
@@ -0,0 +1,135 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// SPKIPin returns the base64 encoded SHA-256 hash of the certificate's
+// subject public key info, the format used in ProxyChecker.TLSPins.
+func SPKIPin(cert *x509.Certificate) string {
+    sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+    return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// fetchPeerCertificates requests target over transport and returns the
+// certificate chain the server presented, without verifying it.
+func (pc *ProxyChecker) fetchPeerCertificates(ctx context.Context, transport *http.Transport, target string) ([]*x509.Certificate, error) {
+    transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+    defer transport.CloseIdleConnections()
+    client := &http.Client{
+        Transport: transport,
+        Timeout:   pc.Client.Timeout,
+        CheckRedirect: func(*http.Request, []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+    req, err := http.NewRequestWithContext(ctx, "HEAD", target, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    resp.Body.Close()
+    if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+        return nil, errors.New("no certificates presented")
+    }
+    return resp.TLS.PeerCertificates, nil
+}
+
+// directPins returns the SPKI pins of the chain target presents when it is
+// fetched without a proxy. Results are cached per host.
+func (pc *ProxyChecker) directPins(ctx context.Context, target string, host string) (map[string]bool, error) {
+    pc.tlsLock.Lock()
+    pins, ok := pc.directTLSPins[host]
+    pc.tlsLock.Unlock()
+    if ok {
+        return pins, nil
+    }
+    chain, err := pc.fetchPeerCertificates(ctx, &http.Transport{}, target)
+    if err != nil {
+        return nil, err
+    }
+    if err := pc.verifyChain(chain, host); err != nil {
+        return nil, err
+    }
+    pins = map[string]bool{}
+    for _, cert := range chain {
+        pins[SPKIPin(cert)] = true
+    }
+    pc.tlsLock.Lock()
+    if pc.directTLSPins == nil {
+        pc.directTLSPins = map[string]map[string]bool{}
+    }
+    pc.directTLSPins[host] = pins
+    pc.tlsLock.Unlock()
+    return pins, nil
+}
+
+func (pc *ProxyChecker) verifyChain(chain []*x509.Certificate, host string) error {
+    intermediates := x509.NewCertPool()
+    for _, cert := range chain[1:] {
+        intermediates.AddCert(cert)
+    }
+    _, err := chain[0].Verify(x509.VerifyOptions{
+        DNSName:       host,
+        Roots:         pc.TLSRootCAs,
+        Intermediates: intermediates,
+    })
+    return err
+}
+
+// checkTLSTampering reports whether the proxy intercepts TLS connections to
+// target. When pins are configured for the host the chain seen through the
+// proxy must contain one of them. Otherwise the chain must verify against
+// TLSRootCAs and share at least one key with the chain seen directly.
+func (pc *ProxyChecker) checkTLSTampering(ctx context.Context, p Proxy, target string) (bool, error) {
+    u, err := url.Parse(target)
+    if err != nil {
+        return false, err
+    }
+    host := u.Hostname()
+    // Not the shared transport: fetching the chain turns off verification.
+    transport, err := pc.newTransport(p)
+    if err != nil {
+        return false, err
+    }
+    chain, err := pc.fetchPeerCertificates(ctx, transport, target)
+    if err != nil {
+        return false, err
+    }
+
+    if pins := pc.TLSPins[host]; len(pins) > 0 {
+        for _, cert := range chain {
+            for _, pin := range pins {
+                if SPKIPin(cert) == pin {
+                    return false, nil
+                }
+            }
+        }
+        return true, nil
+    }
+
+    if err := pc.verifyChain(chain, host); err != nil {
+        return true, nil
+    }
+    direct, err := pc.directPins(ctx, target, host)
+    if err != nil {
+        // Without a reference chain the verified proxied chain is all we have.
+        return false, nil
+    }
+    for _, cert := range chain {
+        if direct[SPKIPin(cert)] {
+            return false, nil
+        }
+    }
+    return true, nil
+}
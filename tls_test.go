@@ -0,0 +1,111 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newImpostorServer starts a TLS server with a freshly generated self-signed
+// certificate for 127.0.0.1, standing in for a proxy's interception endpoint.
+func newImpostorServer(t *testing.T) *httptest.Server {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject:      pkix.Name{CommonName: "impostor"},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+    srv.StartTLS()
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestCheckTLSTampering(t *testing.T) {
+    target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer target.Close()
+    impostor := newImpostorServer(t)
+    impostorAddr := impostor.Listener.Addr().String()
+
+    roots := x509.NewCertPool()
+    roots.AddCert(target.Certificate())
+    pin := SPKIPin(target.Certificate())
+
+    honest := proxyFor(newConnectProxy(t, nil))
+    mitm := proxyFor(newConnectProxy(t, func(string) string { return impostorAddr }))
+
+    tests := []struct {
+        name  string
+        proxy Proxy
+        pins  map[string][]string
+        want  bool
+    }{
+        {"honest", honest, nil, false},
+        {"mitm", mitm, nil, true},
+        {"honest pinned", honest, map[string][]string{"127.0.0.1": {pin}}, false},
+        {"mitm pinned", mitm, map[string][]string{"127.0.0.1": {pin}}, true},
+    }
+    for _, tt := range tests {
+        pc := NewProxyChecker()
+        pc.TLSRootCAs = roots
+        pc.TLSPins = tt.pins
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        tampered, err := pc.checkTLSTampering(ctx, tt.proxy, target.URL)
+        cancel()
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if tampered != tt.want {
+            t.Errorf("%s: tampered = %v, want %v", tt.name, tampered, tt.want)
+        }
+    }
+}
+
+func TestCheckProxyExcludesTLSTampering(t *testing.T) {
+    target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("ok"))
+    }))
+    defer target.Close()
+    roots := x509.NewCertPool()
+    roots.AddCert(target.Certificate())
+
+    pc := NewProxyChecker()
+    pc.Judges = []Judge{{URL: target.URL, Contains: "ok"}}
+    pc.TLSRootCAs = roots
+    pc.DetectTLSTampering = true
+    // Pinning a key the target does not have makes even an honest tunnel
+    // look like interception.
+    pc.TLSPins = map[string][]string{"127.0.0.1": {"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    result, valid := pc.checkProxy(ctx, proxyFor(newConnectProxy(t, nil)), []string{"http"})
+    if valid || !result.TLSTampered {
+        t.Fatalf("expected proxy to be flagged, got valid=%v %+v", valid, result)
+    }
+    if len(pc.GetAllProxies()) != 0 {
+        t.Error("flagged proxy must not be cached")
+    }
+}
@@ -0,0 +1,75 @@
+package proxychecker
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+type transportsKey struct{}
+
+// transportSet holds one transport per proxy URL for the duration of a
+// check, so the probes of a check reuse connections instead of each
+// opening their own.
+type transportSet struct {
+    mu         sync.Mutex
+    transports map[string]*http.Transport
+}
+
+// withTransports returns a context in which pc.transport shares transports,
+// and a function closing them once the check is over.
+func withTransports(ctx context.Context) (context.Context, func()) {
+    set := &transportSet{transports: map[string]*http.Transport{}}
+    return context.WithValue(ctx, transportsKey{}, set), func() {
+        set.mu.Lock()
+        defer set.mu.Unlock()
+        for key, transport := range set.transports {
+            transport.CloseIdleConnections()
+            delete(set.transports, key)
+        }
+    }
+}
+
+// transport returns a transport sending requests through p. Within a check
+// it is shared, otherwise it is new. Either way release must be called once
+// the caller is done with it.
+func (pc *ProxyChecker) transport(ctx context.Context, p Proxy) (*http.Transport, func(), error) {
+    key := p.URL()
+    set, _ := ctx.Value(transportsKey{}).(*transportSet)
+    if set != nil {
+        set.mu.Lock()
+        defer set.mu.Unlock()
+        if transport, ok := set.transports[key]; ok {
+            return transport, func() {}, nil
+        }
+    }
+    transport, err := pc.newTransport(p)
+    if err != nil {
+        return nil, nil, err
+    }
+    if set != nil {
+        set.transports[key] = transport
+        return transport, func() {}, nil
+    }
+    return transport, transport.CloseIdleConnections, nil
+}
+
+// newTransport returns a transport sending requests through p that nothing
+// else shares, for probes that change its settings. It dials with
+// Client.Timeout and verifies TLS against TLSRootCAs.
+func (pc *ProxyChecker) newTransport(p Proxy) (*http.Transport, error) {
+    proxyURL, err := url.Parse(p.URL())
+    if err != nil {
+        return nil, err
+    }
+    transport, err := newProxyTransport(proxyURL, pc.Client.Timeout)
+    if err != nil {
+        return nil, err
+    }
+    if pc.TLSRootCAs != nil {
+        transport.TLSClientConfig = &tls.Config{RootCAs: pc.TLSRootCAs}
+    }
+    return transport, nil
+}
@@ -0,0 +1,96 @@
+package proxychecker
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// dialThrough opens a raw TCP tunnel to addr through the proxy, using CONNECT
+// for HTTP proxies and the native dialers for SOCKS proxies.
+func dialThrough(ctx context.Context, p Proxy, addr string, timeout time.Duration) (net.Conn, error) {
+    switch scheme := p.scheme(); scheme {
+    case "http", "https":
+        return dialHTTPConnect(ctx, p, addr, timeout)
+    case "socks4", "socks4a":
+        return newSocks4Dialer(p.hostPort(), p.Username, scheme == "socks4a", timeout).DialContext(ctx, "tcp", addr)
+    case "socks5", "socks5h":
+        return newSocks5Dialer(p.hostPort(), p.Username, p.Password, scheme == "socks5h", timeout).DialContext(ctx, "tcp", addr)
+    default:
+        return nil, fmt.Errorf("unsupported proxy scheme %q", scheme)
+    }
+}
+
+func dialHTTPConnect(ctx context.Context, p Proxy, addr string, timeout time.Duration) (net.Conn, error) {
+    dialer := &net.Dialer{Timeout: timeout}
+    conn, err := dialer.DialContext(ctx, "tcp", p.hostPort())
+    if err != nil {
+        return nil, err
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+    defer interruptOnDone(ctx, conn)()
+    req := &http.Request{
+        Method: http.MethodConnect,
+        URL:    &url.URL{Opaque: addr},
+        Host:   addr,
+        Header: http.Header{},
+    }
+    if p.Username != "" || p.Password != "" {
+        credentials := base64.StdEncoding.EncodeToString([]byte(p.Username + ":" + p.Password))
+        req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+    }
+    if err := req.Write(conn); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    br := bufio.NewReader(conn)
+    resp, err := http.ReadResponse(br, req)
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        conn.Close()
+        return nil, fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+    }
+    return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// interruptOnDone makes blocking I/O on conn fail as soon as ctx is done, so
+// that a proxy handshake never outlives a cancelled dial. The returned stop
+// function ends the watch and clears the deadline of conn.
+func interruptOnDone(ctx context.Context, conn net.Conn) (stop func()) {
+    done := make(chan struct{})
+    exited := make(chan struct{})
+    go func() {
+        defer close(exited)
+        select {
+        case <-ctx.Done():
+            conn.SetDeadline(time.Unix(1, 0))
+        case <-done:
+        }
+    }()
+    return func() {
+        close(done)
+        <-exited
+        conn.SetDeadline(time.Time{})
+    }
+}
+
+// bufferedConn keeps bytes the proxy sent right after its CONNECT response.
+type bufferedConn struct {
+    net.Conn
+    r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+    return c.r.Read(b)
+}
@@ -2,10 +2,18 @@ package proxychecker
 
 import (
 	"context"
+	"encoding/csv"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func (pc *ProxyChecker) makeRequest(ctx context.Context, url string) (string, error) {
@@ -30,12 +38,78 @@ func (pc *ProxyChecker) makeRequest(ctx context.Context, url string) (string, er
 	return string(body), nil
 }
 
+func newProxyTransport(proxyURL *url.URL, dialTimeout time.Duration) (*http.Transport, error) {
+    switch proxyURL.Scheme {
+    case "socks4", "socks4a":
+        userID := ""
+        if proxyURL.User != nil {
+            userID = proxyURL.User.Username()
+        }
+        dialer := newSocks4Dialer(proxyURL.Host, userID, proxyURL.Scheme == "socks4a", dialTimeout)
+        return &http.Transport{
+            DialContext: dialer.DialContext,
+        }, nil
+    case "socks5", "socks5h":
+        username, password := "", ""
+        if proxyURL.User != nil {
+            username = proxyURL.User.Username()
+            password, _ = proxyURL.User.Password()
+        }
+        dialer := newSocks5Dialer(proxyURL.Host, username, password, proxyURL.Scheme == "socks5h", dialTimeout)
+        return &http.Transport{
+            DialContext: dialer.DialContext,
+        }, nil
+    case "http", "https":
+        return &http.Transport{
+            Proxy: http.ProxyURL(proxyURL),
+            DialContext: (&net.Dialer{
+                Timeout: dialTimeout,
+            }).DialContext,
+        }, nil
+    }
+    return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+}
+
+// isValidProxyFormat accepts host:port where host is an IPv4 address, a
+// bracketed IPv6 literal or a DNS host name, and port is within 1-65535.
 func isValidProxyFormat(proxy string) bool {
-    proxyPattern := `^\d{1,3}(\.\d{1,3}){3}:\d{1,5}$`
-    r := regexp.MustCompile(proxyPattern)
-    return r.MatchString(proxy)
+    host, port, err := net.SplitHostPort(proxy)
+    if err != nil {
+        return false
+    }
+    n, err := strconv.Atoi(port)
+    if err != nil || n < 1 || n > 65535 {
+        return false
+    }
+    if strings.HasPrefix(proxy, "[") {
+        ip := net.ParseIP(host)
+        return ip != nil && strings.Contains(host, ":")
+    }
+    if ip := net.ParseIP(host); ip != nil {
+        return ip.To4() != nil
+    }
+    return isValidHostname(host)
+}
+
+func isValidHostname(host string) bool {
+    host = strings.TrimSuffix(host, ".")
+    if host == "" || len(host) > 253 {
+        return false
+    }
+    labels := strings.Split(host, ".")
+    for _, label := range labels {
+        if !hostnameLabelRegexp.MatchString(label) {
+            return false
+        }
+    }
+    // An all-numeric last label is a malformed IPv4 address such as
+    // 999.1.1.1, not a host name.
+    _, err := strconv.Atoi(labels[len(labels)-1])
+    return err != nil
 }
 
+var hostnameLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
 func (pc *ProxyChecker) SaveProxiesToFile(filename string) error {
     pc.CacheLock.Lock()
     defer pc.CacheLock.Unlock()
@@ -47,7 +121,7 @@ func (pc *ProxyChecker) SaveProxiesToFile(filename string) error {
     defer file.Close()
 
     for _, proxy := range pc.Cache {
-        fullProxy := proxy.Address
+        fullProxy := proxy.URL()
         _, err := file.WriteString(fullProxy + "\n")
         if err != nil {
             return err
@@ -55,4 +129,72 @@ func (pc *ProxyChecker) SaveProxiesToFile(filename string) error {
     }
 
     return nil
-}
\ No newline at end of file
+}
+
+// SaveProxiesToFileIn is like SaveProxiesToFile but only writes the proxies
+// whose traffic leaves within loc, see GetProxiesIn.
+func (pc *ProxyChecker) SaveProxiesToFileIn(filename string, loc Location) error {
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    for _, proxy := range pc.GetProxiesIn(loc) {
+        if _, err := file.WriteString(proxy.URL() + "\n"); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// SaveProxyReportToFile writes the cached proxies as CSV, fastest first,
+// together with the timings measured when they were checked.
+func (pc *ProxyChecker) SaveProxyReportToFile(filename string) error {
+    proxies := pc.GetProxiesByLatency()
+
+    file, err := os.Create(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    w := csv.NewWriter(file)
+    w.Write([]string{"proxy", "type", "connect_ms", "tls_handshake_ms", "first_byte_ms", "total_ms", "anonymity", "capabilities", "exit_ip", "rotating", "throughput_bps", "success_ratio", "latency_spread_ms", "targets", "country", "region", "city", "exit_country", "exit_region", "exit_city"})
+    for _, proxy := range proxies {
+        w.Write([]string{
+            proxy.URL(),
+            proxy.Type,
+            formatMillis(proxy.Timings.Connect),
+            formatMillis(proxy.Timings.TLSHandshake),
+            formatMillis(proxy.Timings.FirstByte),
+            formatMillis(proxy.Timings.Total),
+            string(proxy.Anonymity),
+            proxy.Capabilities.String(),
+            proxy.ExitIP,
+            strconv.FormatBool(proxy.Rotating),
+            strconv.FormatFloat(proxy.Throughput, 'f', 0, 64),
+            strconv.FormatFloat(proxy.SuccessRatio, 'f', 2, 64),
+            formatMillis(proxy.LatencySpread),
+            strings.Join(proxy.Targets.passed(), "|"),
+            proxy.Location.Country,
+            proxy.Location.Region,
+            proxy.Location.City,
+            proxy.ExitLocation.Country,
+            proxy.ExitLocation.Region,
+            proxy.ExitLocation.City,
+        })
+    }
+    w.Flush()
+    return w.Error()
+}
+
+func sortByLatency(proxies []Proxy) {
+    sort.SliceStable(proxies, func(i, j int) bool {
+        return proxies[i].Timings.Total < proxies[j].Timings.Total
+    })
+}
+
+func formatMillis(d time.Duration) string {
+    return strconv.FormatInt(d.Milliseconds(), 10)
+}